@@ -0,0 +1,88 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// WithAcquisitionTiming makes reads and master execs report the time spent waiting for a pooled
+// connection apart from the execution time, through Observer.OnQueryTiming and the WithOnPoolWait hook.
+// It tells pool contention from slow queries. It has no effect without any of them.
+//
+// The wait is read from the wait duration of the pool statistics, see sql.DBStats, before and after
+// the call: the calls are made as usual, but the waits of concurrent calls on the same node ending
+// during the call are counted too. It is capped to the duration of the call.
+func WithAcquisitionTiming(enabled bool) Option {
+	return func(db *DB) {
+		db.acquisitionTiming = enabled
+	}
+}
+
+// timed reports whether the call made with ctx must time connection acquisition
+func (db *DB) timed(ctx context.Context) bool {
+	return db.acquisitionTiming && (db.observer != nil || db.onPoolWait != nil) && instrumented(ctx)
+}
+
+// WithOnPoolWait registers a hook invoked when a call waited at least threshold for a pooled
+// connection of node. ctx is the context of the call, so the wait can be recorded on its trace span,
+// e.g. as a pool.wait_ms attribute. It requires WithAcquisitionTiming.
+func WithOnPoolWait(threshold time.Duration, fn func(ctx context.Context, node string, wait time.Duration)) Option {
+	return func(db *DB) {
+		db.poolWaitThreshold = threshold
+		db.onPoolWait = fn
+	}
+}
+
+// acquired reports the timing of a call on node which waited wait for its connection and then executed for exec
+func (db *DB) acquired(ctx context.Context, node string, wait, exec time.Duration) {
+	if db.observer != nil {
+		db.observer.OnQueryTiming(node, wait, exec)
+	}
+	if db.onPoolWait != nil && wait >= db.poolWaitThreshold {
+		db.onPoolWait(ctx, node, wait)
+	}
+}
+
+// queryOn executes query on conn, which is node
+func (db *DB) queryOn(ctx context.Context, node string, conn *sql.DB, query string, args []interface{}) (*sql.Rows, error) {
+	if !db.timed(ctx) {
+		return conn.QueryContext(ctx, query, args...)
+	}
+	var rows *sql.Rows
+	err := db.timedCall(ctx, node, conn, func() error {
+		var err error
+		rows, err = conn.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// execOn executes query on conn, which is node
+func (db *DB) execOn(ctx context.Context, node string, conn *sql.DB, query string, args []interface{}) (sql.Result, error) {
+	if !db.timed(ctx) {
+		return conn.ExecContext(ctx, query, args...)
+	}
+	var result sql.Result
+	err := db.timedCall(ctx, node, conn, func() error {
+		var err error
+		result, err = conn.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+// timedCall runs call on conn, which is node, and reports how long it waited for a pooled connection
+// and then executed, see WithAcquisitionTiming
+func (db *DB) timedCall(ctx context.Context, node string, conn *sql.DB, call func() error) error {
+	waited := conn.Stats().WaitDuration
+	start := time.Now()
+	err := call()
+	elapsed := time.Since(start)
+	wait := conn.Stats().WaitDuration - waited
+	if wait > elapsed {
+		wait = elapsed
+	}
+	db.acquired(ctx, node, wait, elapsed-wait)
+	return err
+}
@@ -0,0 +1,97 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// queryTimings records the query timings reported to it
+type queryTimings struct {
+	NopObserver
+	m     sync.Mutex
+	nodes []string
+}
+
+func (o *queryTimings) OnQueryTiming(node string, acquire, exec time.Duration) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.nodes = append(o.nodes, node)
+}
+
+func TestDB_AcquisitionTiming(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	observer := &queryTimings{}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1},
+		WithObserver(observer), WithAcquisitionTiming(true))
+	assert.Nil(t, err)
+	replica1.SetMaxOpenConns(1)
+
+	// the connection is back to the pool once rows are closed, so the second query can run
+	for i := 0; i < 2; i++ {
+		mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}).AddRow(1))
+		rows, err := db.Query("Query1")
+		assert.Nil(t, err)
+		assert.True(t, rows.Next())
+		assert.Nil(t, rows.Close())
+	}
+	mock.ExpectExec("Insert1").WillReturnResult(sqlmock.NewResult(1, 1))
+	_, err = db.Exec("Insert1")
+	assert.Nil(t, err)
+
+	assert.Equal(t, observer.nodes, []string{"replica-0", "replica-0", masterNode})
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
+
+func TestDB_OnPoolWait(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waits := make(chan time.Duration, 2)
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1},
+		WithAcquisitionTiming(true),
+		WithOnPoolWait(10*time.Millisecond, func(ctx context.Context, node string, wait time.Duration) {
+			assert.Equal(t, node, "replica-0")
+			waits <- wait
+		}),
+	)
+	assert.Nil(t, err)
+	replica1.SetMaxOpenConns(1)
+
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}).AddRow(1))
+	mock1.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	rows, err := db.Query("Query1")
+	assert.Nil(t, err)
+	// Query2 waits for the only connection, held by the rows of Query1
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rows, err := db.Query("Query2")
+		assert.Nil(t, err)
+		rows.Close()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	assert.Nil(t, rows.Close())
+	<-done
+
+	assert.Len(t, waits, 1)
+	assert.True(t, <-waits >= 10*time.Millisecond)
+}
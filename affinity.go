@@ -0,0 +1,68 @@
+package mydb
+
+import (
+	"context"
+	"sync"
+)
+
+// replicaAffinity is the replica pinned by the reads made with a context, see WithReplicaAffinity
+type replicaAffinity struct {
+	m      sync.Mutex
+	index  int
+	pinned bool
+}
+
+// WithReplicaAffinity returns a copy of ctx whose reads stick to the same replica,
+// e.g. for the reads of an HTTP request to see a consistent snapshot of the replication.
+// The first read made with it pins the replica which served it, the following reads
+// try that replica first. When the pinned replica fails, the read fails over as usual
+// and the replica which served it is pinned instead.
+//
+// The pin is shared by every context derived from the returned one.
+func WithReplicaAffinity(ctx context.Context) context.Context {
+	return context.WithValue(orBackground(ctx), replicaAffinityKey, &replicaAffinity{})
+}
+
+// affinityOf returns the replica affinity of ctx, nil when it has none
+func affinityOf(ctx context.Context) *replicaAffinity {
+	a, _ := ctx.Value(replicaAffinityKey).(*replicaAffinity)
+	return a
+}
+
+// lookup returns the pinned replica index
+func (a *replicaAffinity) lookup() (int, bool) {
+	if a == nil {
+		return 0, false
+	}
+	a.m.Lock()
+	defer a.m.Unlock()
+	return a.index, a.pinned
+}
+
+// pin records the replica at index served a read
+func (a *replicaAffinity) pin(index int) {
+	if a == nil {
+		return
+	}
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.index = index
+	a.pinned = true
+}
+
+// preferPinned moves the replica pinned by ctx to the front of order, if it is part of it
+func preferPinned(ctx context.Context, order []candidate) []candidate {
+	if index, ok := affinityOf(ctx).lookup(); ok {
+		return preferFirst(order, index)
+	}
+	return order
+}
+
+// readOrderFor returns the read order of a read made with ctx, see readOrder, WithRoutingKey and WithReplicaAffinity
+func (db *DB) readOrderFor(ctx context.Context) ([]candidate, error) {
+	order, err := db.readOrderKeyed(routingKeyOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return preferPinned(ctx, order), nil
+}
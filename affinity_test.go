@@ -0,0 +1,49 @@
+package mydb
+
+import (
+	"context"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithReplicaAffinity(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+
+	// round robin picks replica2 first, the following reads stick to it
+	ctx := WithReplicaAffinity(context.Background())
+	for i := 0; i < 3; i++ {
+		mock2.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+		_, err = db.QueryContext(ctx, "Query1")
+		assert.Nil(t, err)
+	}
+
+	// the pinned replica fails, replica1 serves the read and is pinned
+	replica2.Close()
+	mock1.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	mock1.ExpectQuery("Query3").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.QueryContext(ctx, "Query2")
+	assert.Nil(t, err)
+	index, ok := affinityOf(ctx).lookup()
+	assert.True(t, ok)
+	assert.Equal(t, index, 0)
+	_, err = db.QueryContext(ctx, "Query3")
+	assert.Nil(t, err)
+
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
@@ -0,0 +1,320 @@
+package mydb
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaState is the view of a read replica handed to a Balancer.
+type ReplicaState struct {
+	// Index is the position of the replica in the replica set, i.e. the order passed to New
+	Index int
+	// Lag is the last replication lag measured by RefreshLag, 0 when never measured
+	Lag time.Duration
+	// InUse is the number of connections of the replica currently in use.
+	// It is only filled in for the balancers implementing ConnectionsBalancer, 0 otherwise.
+	InUse int
+	// Weight is the weight of the replica given to NewWeighted, 1 for replicas of other constructors
+	Weight int
+	// Latency is the moving average of the latency of the reads served by the replica, 0 till one is served
+	Latency time.Duration
+	// Priority is the priority of the replica given to NewWithReplicas, see ReplicaConfig.Priority.
+	// The replicas handed to Pick all have the same priority.
+	Priority int
+}
+
+// Balancer selects the read replica which serves the next read.
+// Implementations must be safe for concurrent use by multiple goroutines.
+type Balancer interface {
+	// Pick returns the position in replicas of the replica to read from.
+	// replicas is never empty.
+	Pick(replicas []ReplicaState) int
+}
+
+// ConnectionsBalancer is implemented by the balancers picking replicas by their connections in use.
+// ReplicaState.InUse is only filled in for them: reading the pool statistics of a replica takes
+// the lock of its pool, which the other balancers have no reason to take on every read.
+type ConnectionsBalancer interface {
+	Balancer
+	// UsesConnections reports whether Pick reads ReplicaState.InUse
+	UsesConnections() bool
+}
+
+// WithBalancer replaces the default round-robin replica selection with b.
+func WithBalancer(b Balancer) Option {
+	return func(db *DB) {
+		if b != nil {
+			db.balancer = b
+		}
+	}
+}
+
+// BalancerName returns a human-readable identifier of the configured Balancer,
+// e.g. "round-robin", "random", "least-connections" or "weighted".
+// A custom Balancer is named by its Name method when it has one, "custom" otherwise.
+func (db *DB) BalancerName() string {
+	if named, ok := db.balancer.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return "custom"
+}
+
+// BalanceStrategy is a built-in replica selection strategy, see WithBalanceStrategy.
+type BalanceStrategy int
+
+const (
+	// RoundRobin walks the replicas one after the other, it is the default strategy
+	RoundRobin BalanceStrategy = iota
+	// Random picks a replica at random, drawing from the source set with WithRand
+	Random
+	// LeastConnections picks the replica with the fewest connections in use
+	LeastConnections
+	// LowestLatency picks replicas at random, biased toward the ones serving reads the fastest:
+	// the chance of a replica being picked is inversely proportional to its latency
+	LowestLatency
+)
+
+// WithBalanceStrategy selects replicas with one of the built-in strategies.
+// Unknown strategies fall back to RoundRobin.
+func WithBalanceStrategy(strategy BalanceStrategy) Option {
+	return func(db *DB) {
+		switch strategy {
+		case Random:
+			db.balancer = randomBalancer{db: db}
+		case LeastConnections:
+			db.balancer = &leastConnections{}
+		case LowestLatency:
+			db.balancer = lowestLatency{db: db}
+		default:
+			db.balancer = &roundRobin{}
+		}
+	}
+}
+
+// roundRobin is the default Balancer, it walks the replicas one after the other
+// from a random start, see seedRoundRobin.
+type roundRobin struct {
+	// count is the number of picks, accessed atomically. Being unsigned it wraps to 0
+	// instead of turning negative, which would make the modulo a negative index.
+	count uint64
+}
+
+func (rr *roundRobin) Pick(replicas []ReplicaState) int {
+	return int(atomic.AddUint64(&rr.count, 1) % uint64(len(replicas)))
+}
+
+// roundRobinStart draws the replica among n the round robin starts at, replaced by the tests
+var roundRobinStart = func(db *DB, n int) int {
+	return db.randIntn(n)
+}
+
+// seedRoundRobin starts the round robin of the built-in balancers at a random replica among n,
+// drawn from the source set with WithRand, so that the processes of a fleet deployed at once
+// don't all send their first reads to the same replica
+func (db *DB) seedRoundRobin(n int) {
+	switch b := db.balancer.(type) {
+	case *roundRobin:
+		b.count = uint64(roundRobinStart(db, n))
+	case *leastConnections:
+		b.rr.count = uint64(roundRobinStart(db, n))
+	}
+}
+
+// ResetBalancer sets the built-in balancers back to their initial state, without the random
+// start of seedRoundRobin, so that the replicas are walked in the same order as on a fresh DB
+// started at replica 0. A custom Balancer is reset by its Reset method when it has one.
+//
+// It is a testing and operational aid, e.g. to get deterministic reads after a reconfiguration.
+func (db *DB) ResetBalancer() {
+	switch b := db.balancer.(type) {
+	case *roundRobin:
+		b.reset()
+	case *leastConnections:
+		b.rr.reset()
+	case *weightedRoundRobin:
+		b.m.Lock()
+		b.current = nil
+		b.rr.reset()
+		b.m.Unlock()
+	case interface{ Reset() }:
+		b.Reset()
+	}
+}
+
+// reset sets the pick count back to 0
+func (rr *roundRobin) reset() {
+	atomic.StoreUint64(&rr.count, 0)
+}
+
+func (rr *roundRobin) Name() string {
+	return "round-robin"
+}
+
+// randomBalancer picks replicas at random
+type randomBalancer struct {
+	db *DB
+}
+
+func (rb randomBalancer) Pick(replicas []ReplicaState) int {
+	return rb.db.randIntn(len(replicas))
+}
+
+func (rb randomBalancer) Name() string {
+	return "random"
+}
+
+// leastConnections picks the replica with the fewest connections in use,
+// ties are broken round-robin so idle replicas share the load.
+type leastConnections struct {
+	rr roundRobin
+}
+
+func (lc *leastConnections) Pick(replicas []ReplicaState) int {
+	start := lc.rr.Pick(replicas)
+	picked := start
+	for i := 1; i < len(replicas); i++ {
+		candidate := (start + i) % len(replicas)
+		if replicas[candidate].InUse < replicas[picked].InUse {
+			picked = candidate
+		}
+	}
+	return picked
+}
+
+func (lc *leastConnections) UsesConnections() bool {
+	return true
+}
+
+func (lc *leastConnections) Name() string {
+	return "least-connections"
+}
+
+// lowestLatency picks replicas at random, weighted by the inverse of their latency.
+// Replicas which never served a read are weighted like the fastest one, so they get measured.
+type lowestLatency struct {
+	db *DB
+}
+
+func (ll lowestLatency) Pick(replicas []ReplicaState) int {
+	var fastest time.Duration
+	for _, r := range replicas {
+		if r.Latency > 0 && (fastest == 0 || r.Latency < fastest) {
+			fastest = r.Latency
+		}
+	}
+	if fastest == 0 {
+		return ll.db.randIntn(len(replicas))
+	}
+	weights := make([]float64, len(replicas))
+	var total float64
+	for i, r := range replicas {
+		weights[i] = 1
+		if r.Latency > 0 {
+			weights[i] = float64(fastest) / float64(r.Latency)
+		}
+		total += weights[i]
+	}
+	target := ll.db.randFloat64() * total
+	for i, w := range weights {
+		if target < w {
+			return i
+		}
+		target -= w
+	}
+	return len(replicas) - 1
+}
+
+func (ll lowestLatency) Name() string {
+	return "lowest-latency"
+}
+
+// candidate is a replica selected for a read, along with its index when it was selected
+type candidate struct {
+	*replica
+	index int
+	// probe is set when the read was granted the probe of the circuit breaker of the replica
+	probe bool
+}
+
+// readOrder returns the replicas a read tries one after the other:
+// the replica picked by the balancer among the replicas of the highest priority first,
+// then the following eligible replicas for failover, tier after tier.
+// Every replica appears once at most, so a read makes at most one attempt per replica, retries aside,
+// and never goes back to a replica which failed it.
+// The replicas are captured at selection time, so they stay valid whatever happens to the replica set afterwards.
+func (db *DB) readOrder() ([]candidate, error) {
+	return db.readOrderKeyed(0, false)
+}
+
+// readOrderKeyed is readOrder, the first replica being picked from the hash of a routing key
+// instead of by the balancer when keyed, see WithRoutingKey
+func (db *DB) readOrderKeyed(hash uint32, keyed bool) ([]candidate, error) {
+	replicas := db.replicas()
+	states := make([]ReplicaState, len(replicas))
+	b, ok := db.balancer.(ConnectionsBalancer)
+	inUse := ok && b.UsesConnections() && !keyed
+	for i, r := range replicas {
+		states[i] = ReplicaState{Index: i, Weight: r.weight, Latency: r.lastLatency(), Priority: r.priority}
+		if inUse {
+			states[i].InUse = r.db.Stats().InUse
+		}
+		if lag, ok := r.lastLag(); ok {
+			states[i].Lag = lag
+		}
+	}
+	states, err := undrainedReplicas(replicas, states)
+	if err != nil {
+		return nil, err
+	}
+	states, err = db.freshReplicas(upReplicas(replicas, states))
+	if err != nil {
+		return nil, err
+	}
+	// the breakers are checked last: every replica granted a probe makes it into the order
+	states, probes := db.closedReplicas(replicas, states)
+	// the balancer picks among the replicas of the highest priority, the lower tiers follow for failover
+	tiers := priorityTiers(states)
+	var picked int
+	if keyed {
+		picked = keyedPick(hash, len(replicas), tiers[0])
+	} else {
+		picked = db.balancer.Pick(tiers[0])
+	}
+	if picked < 0 || picked >= len(tiers[0]) {
+		// a misbehaving balancer must not make reads panic
+		picked = 0
+	}
+	// replicas weighted 0 are kept for failover when no other replica is left
+	order := make([]candidate, 0, len(states))
+	var lastStanding []candidate
+	for t, tier := range tiers {
+		// the lower tiers are walked from an offset following the pick, to spread the failovers
+		start := picked % len(tier)
+		for i := range tier {
+			state := tier[(start+i)%len(tier)]
+			c := candidate{replica: replicas[state.Index], index: state.Index, probe: probes != nil && probes[state.Index]}
+			if state.Weight <= 0 && (t > 0 || i > 0) {
+				lastStanding = append(lastStanding, c)
+				continue
+			}
+			order = append(order, c)
+		}
+	}
+	return append(order, lastStanding...), nil
+}
+
+// priorityTiers groups states by priority, the highest first, keeping the order of the replicas in a tier
+func priorityTiers(states []ReplicaState) [][]ReplicaState {
+	sorted := make([]ReplicaState, len(states))
+	copy(sorted, states)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Priority > sorted[j].Priority })
+	var tiers [][]ReplicaState
+	for i, state := range sorted {
+		if i == 0 || state.Priority != sorted[i-1].Priority {
+			tiers = append(tiers, nil)
+		}
+		tiers[len(tiers)-1] = append(tiers[len(tiers)-1], state)
+	}
+	return tiers
+}
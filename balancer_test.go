@@ -0,0 +1,377 @@
+package mydb
+
+import (
+	"database/sql"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// lastReplica always picks the last replica
+type lastReplica struct{}
+
+func (lastReplica) Pick(replicas []ReplicaState) int {
+	return len(replicas) - 1
+}
+
+// namedBalancer is a custom Balancer with a name
+type namedBalancer struct {
+	lastReplica
+}
+
+func (namedBalancer) Name() string {
+	return "last"
+}
+
+func TestDB_WithBalancer(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2}, WithBalancer(lastReplica{}))
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		mock2.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+		_, err = db.Query("Query1")
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
+func TestRoundRobin_Pick(t *testing.T) {
+	rr := &roundRobin{}
+	replicas := []ReplicaState{{Index: 0}, {Index: 1}, {Index: 2}}
+	var picks []int
+	for i := 0; i < 4; i++ {
+		picks = append(picks, rr.Pick(replicas))
+	}
+	assert.Equal(t, picks, []int{1, 2, 0, 1})
+
+	// the count wraps around without going negative
+	rr.count = math.MaxUint64 - 1
+	assert.Equal(t, rr.Pick(replicas), int(uint64(math.MaxUint64)%3))
+	assert.Equal(t, rr.Pick(replicas), 0)
+	assert.Equal(t, rr.Pick(replicas), 1)
+}
+
+func TestDB_SeedRoundRobin(t *testing.T) {
+	defer func(start func(*DB, int) int) { roundRobinStart = start }(roundRobinStart)
+	roundRobinStart = func(db *DB, n int) int { return db.randIntn(n) }
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicas := make([]*sql.DB, 3)
+	for i := range replicas {
+		if replicas[i], _, err = sqlmock.New(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the start is drawn from the source of randomness, so a seed reproduces it
+	starts := map[uint64]bool{}
+	for seed := int64(0); seed < 20; seed++ {
+		db, err := NewWithOptions(masterDB, replicas, WithRand(rand.New(rand.NewSource(seed))))
+		assert.Nil(t, err)
+		count := db.balancer.(*roundRobin).count
+		assert.Equal(t, count, uint64(rand.New(rand.NewSource(seed)).Intn(3)))
+		starts[count] = true
+	}
+	assert.Len(t, starts, 3)
+
+	db, err := NewWithOptions(masterDB, replicas, WithRand(rand.New(rand.NewSource(1))), WithBalanceStrategy(LeastConnections))
+	assert.Nil(t, err)
+	assert.Equal(t, db.balancer.(*leastConnections).rr.count, uint64(rand.New(rand.NewSource(1)).Intn(3)))
+}
+
+// resettable is a custom Balancer counting its resets
+type resettable struct {
+	roundRobin
+	resets int
+}
+
+func (r *resettable) Reset() {
+	r.resets++
+}
+
+func TestDB_ResetBalancer(t *testing.T) {
+	defer func(start func(*DB, int) int) { roundRobinStart = start }(roundRobinStart)
+	roundRobinStart = func(db *DB, n int) int { return db.randIntn(n) }
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicas := make([]*sql.DB, 3)
+	for i := range replicas {
+		if replicas[i], _, err = sqlmock.New(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := func(db *DB) int {
+		order, err := db.readOrder()
+		assert.Nil(t, err)
+		return order[0].index
+	}
+
+	// the reads walk the replicas in the same order whatever the random start
+	for seed := int64(0); seed < 3; seed++ {
+		db, err := NewWithOptions(masterDB, replicas, WithRand(rand.New(rand.NewSource(seed))))
+		assert.Nil(t, err)
+		first(db)
+		db.ResetBalancer()
+		assert.Equal(t, []int{first(db), first(db), first(db)}, []int{1, 2, 0})
+	}
+
+	weighted := make([]WeightedReplica, len(replicas))
+	for i := range replicas {
+		weighted[i] = WeightedReplica{DB: replicas[i], Weight: i + 1}
+	}
+	db, err := NewWeighted(masterDB, weighted)
+	assert.Nil(t, err)
+	picks := []int{first(db), first(db), first(db)}
+	db.ResetBalancer()
+	assert.Equal(t, []int{first(db), first(db), first(db)}, picks)
+
+	custom := &resettable{}
+	db, err = NewWithOptions(masterDB, replicas, WithBalancer(custom))
+	assert.Nil(t, err)
+	db.ResetBalancer()
+	assert.Equal(t, custom.resets, 1)
+}
+
+func TestLeastConnections_Pick(t *testing.T) {
+	lc := &leastConnections{}
+	busy := []ReplicaState{{Index: 0, InUse: 4}, {Index: 1, InUse: 2}, {Index: 2, InUse: 7}}
+	assert.Equal(t, lc.Pick(busy), 1)
+	assert.Equal(t, lc.Pick(busy), 1)
+	// idle replicas share the load
+	idle := []ReplicaState{{Index: 0}, {Index: 1}, {Index: 2}}
+	var picks []int
+	for i := 0; i < 3; i++ {
+		picks = append(picks, lc.Pick(idle))
+	}
+	assert.ElementsMatch(t, picks, []int{0, 1, 2})
+}
+
+func TestDB_WithBalanceStrategy(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2},
+		WithBalanceStrategy(Random), WithRand(rand.New(rand.NewSource(1))))
+	assert.Nil(t, err)
+	expected := rand.New(rand.NewSource(1))
+	replicas := []ReplicaState{{Index: 0}, {Index: 1}}
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, db.balancer.Pick(replicas), expected.Intn(2))
+	}
+
+	db, err = NewWithOptions(masterDB, []*sql.DB{replica1, replica2}, WithBalanceStrategy(LeastConnections))
+	assert.Nil(t, err)
+	assert.IsType(t, db.balancer, &leastConnections{})
+	db, err = NewWithOptions(masterDB, []*sql.DB{replica1, replica2}, WithBalanceStrategy(BalanceStrategy(42)))
+	assert.Nil(t, err)
+	assert.IsType(t, db.balancer, &roundRobin{})
+}
+
+func TestDB_ReadOrderCapturesReplicas(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+	order, err := db.readOrder()
+	assert.Nil(t, err)
+	assert.Equal(t, order[0].index, 1)
+
+	// the replica set shrinks between selection and use
+	db.replicasMu.Lock()
+	db.readreplicas = db.readreplicas[:1]
+	db.replicasMu.Unlock()
+	mock2.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = order[0].db.Query("Query1")
+	assert.Nil(t, err)
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
+func TestDB_PriorityTiers(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs := make([]ReplicaConfig, 4)
+	mocks := make([]sqlmock.Sqlmock, 4)
+	for i := range configs {
+		r, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		configs[i] = ReplicaConfig{DB: r}
+		mocks[i] = mock
+	}
+	// the first two replicas are in the local zone
+	configs[0].Priority = 1
+	configs[1].Priority = 1
+	db, err := NewWithReplicas(masterDB, configs)
+	assert.Nil(t, err)
+
+	indexes := func() []int {
+		order, err := db.readOrder()
+		assert.Nil(t, err)
+		var indexes []int
+		for _, c := range order {
+			indexes = append(indexes, c.index)
+		}
+		return indexes
+	}
+	// round robin within the local zone, the other zone for failover only
+	assert.Equal(t, indexes(), []int{1, 0, 3, 2})
+	assert.Equal(t, indexes(), []int{0, 1, 2, 3})
+
+	// the local zone fails, the read crosses zones
+	mocks[1].ExpectQuery("Query1").WillReturnError(sql.ErrConnDone)
+	mocks[0].ExpectQuery("Query1").WillReturnError(sql.ErrConnDone)
+	mocks[3].ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query1")
+	assert.Nil(t, err)
+	for _, mock := range mocks {
+		assert.Nil(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestDB_BalancerName(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for expected, opt := range map[string]Option{
+		"round-robin":       WithBalanceStrategy(RoundRobin),
+		"random":            WithBalanceStrategy(Random),
+		"least-connections": WithBalanceStrategy(LeastConnections),
+		"lowest-latency":    WithBalanceStrategy(LowestLatency),
+		"custom":            WithBalancer(lastReplica{}),
+		"last":              WithBalancer(namedBalancer{}),
+	} {
+		db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, opt)
+		assert.Nil(t, err)
+		assert.Equal(t, db.BalancerName(), expected)
+	}
+	db, err := NewWeighted(masterDB, []WeightedReplica{{DB: replica1, Weight: 1}})
+	assert.Nil(t, err)
+	assert.Equal(t, db.BalancerName(), "weighted")
+}
+
+func TestLowestLatency_Pick(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1},
+		WithBalanceStrategy(LowestLatency), WithRand(rand.New(rand.NewSource(1))))
+	assert.Nil(t, err)
+
+	replicas := []ReplicaState{{Index: 0, Latency: 10 * time.Millisecond}, {Index: 1, Latency: 90 * time.Millisecond}}
+	picks := make([]int, 2)
+	for i := 0; i < 1000; i++ {
+		picks[db.balancer.Pick(replicas)]++
+	}
+	// replica 0 is picked about 9 times out of 10
+	assert.True(t, picks[0] > 850 && picks[0] < 950, picks)
+
+	// latency is measured on every read served
+	assert.Equal(t, db.ReplicaLatencies(), []time.Duration{0})
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query1")
+	assert.Nil(t, err)
+	assert.True(t, db.ReplicaLatencies()[0] > 0)
+}
+
+func TestReplica_ObserveLatency(t *testing.T) {
+	r := &replica{}
+	r.observeLatency(100 * time.Millisecond)
+	assert.Equal(t, r.lastLatency(), 100*time.Millisecond)
+	r.observeLatency(200 * time.Millisecond)
+	assert.Equal(t, r.lastLatency(), 120*time.Millisecond)
+}
+
+// connectionsRecorder records the states handed to Pick, reading InUse when uses is set
+type connectionsRecorder struct {
+	uses   bool
+	states []ReplicaState
+}
+
+func (c *connectionsRecorder) Pick(replicas []ReplicaState) int {
+	c.states = replicas
+	return 0
+}
+
+func (c *connectionsRecorder) UsesConnections() bool {
+	return c.uses
+}
+
+func TestDB_BalancerInUse(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a connection of replica1 is in use
+	mock1.ExpectBegin()
+	tx, err := replica1.Begin()
+	assert.Nil(t, err)
+	defer tx.Rollback()
+
+	// the pool statistics are read for the balancers using them only
+	recorder := &connectionsRecorder{}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithBalancer(recorder))
+	assert.Nil(t, err)
+	_, err = db.readOrder()
+	assert.Nil(t, err)
+	assert.Equal(t, recorder.states[0].InUse, 0)
+
+	recorder.uses = true
+	_, err = db.readOrder()
+	assert.Nil(t, err)
+	assert.Equal(t, recorder.states[0].InUse, 1)
+}
@@ -0,0 +1,26 @@
+// Package balancertest provides utilities to verify mydb.Balancer implementations
+// without real databases.
+package balancertest
+
+import mydb "github.com/rosspatil/sql-db-mocking"
+
+// SimulateSelections runs balancer iterations times against a synthetic set of
+// replicas and returns how many times each replica was picked, indexed by replica.
+// A pick outside of the replica set is not counted, no replica at all gives an empty histogram.
+func SimulateSelections(balancer mydb.Balancer, replicas, iterations int) []int {
+	if replicas <= 0 {
+		return []int{}
+	}
+	histogram := make([]int, replicas)
+	states := make([]mydb.ReplicaState, replicas)
+	for i := range states {
+		states[i] = mydb.ReplicaState{Index: i, Weight: 1}
+	}
+	for i := 0; i < iterations; i++ {
+		picked := balancer.Pick(states)
+		if picked >= 0 && picked < replicas {
+			histogram[picked]++
+		}
+	}
+	return histogram
+}
@@ -0,0 +1,53 @@
+package balancertest
+
+import (
+	"math/rand"
+	"testing"
+
+	mydb "github.com/rosspatil/sql-db-mocking"
+	"github.com/stretchr/testify/assert"
+)
+
+// roundRobin walks the replicas one after the other, starting at the first one
+type roundRobin struct {
+	count int
+}
+
+func (rr *roundRobin) Pick(replicas []mydb.ReplicaState) int {
+	picked := rr.count % len(replicas)
+	rr.count++
+	return picked
+}
+
+// randomBalancer picks replicas at random
+type randomBalancer struct {
+	rnd *rand.Rand
+}
+
+func (rb randomBalancer) Pick(replicas []mydb.ReplicaState) int {
+	return rb.rnd.Intn(len(replicas))
+}
+
+// outOfRange picks a replica which is not part of the set
+type outOfRange struct{}
+
+func (outOfRange) Pick(replicas []mydb.ReplicaState) int {
+	return len(replicas)
+}
+
+func TestSimulateSelections(t *testing.T) {
+	assert.Equal(t, SimulateSelections(&roundRobin{}, 3, 10), []int{4, 3, 3})
+
+	histogram := SimulateSelections(randomBalancer{rand.New(rand.NewSource(1))}, 3, 3000)
+	assert.Len(t, histogram, 3)
+	total := 0
+	for _, picks := range histogram {
+		assert.True(t, picks > 800 && picks < 1200)
+		total += picks
+	}
+	assert.Equal(t, total, 3000)
+
+	assert.Equal(t, SimulateSelections(outOfRange{}, 2, 10), []int{0, 0})
+	assert.Equal(t, SimulateSelections(&roundRobin{}, 0, 10), []int{})
+	assert.Equal(t, SimulateSelections(&roundRobin{}, -1, 10), []int{})
+}
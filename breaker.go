@@ -0,0 +1,165 @@
+package mydb
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of the circuit breaker of a replica, see WithCircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets reads reach the replica, it is the state of every replica without a circuit breaker
+	BreakerClosed BreakerState = iota
+	// BreakerOpen skips the replica till the cooldown is over
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe read reach the replica to test its recovery
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// WithCircuitBreaker opens the circuit breaker of a replica after failures consecutive
+// failed reads, reads then skip the replica for cooldown, after which a single probe read
+// is let through: its success closes the breaker, its failure opens it for another cooldown.
+// Only connection failures count, a query failing on its own is no sign of a flapping replica.
+// When every breaker is open, reads still try all the replicas.
+//
+// A failures of 0 or less disables the breakers, which is the default.
+func WithCircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(db *DB) {
+		db.breakerFailures = failures
+		db.breakerCooldown = cooldown
+	}
+}
+
+// BreakerState returns the state of the circuit breaker of the replica at index, in the order passed to New.
+func (db *DB) BreakerState(index int) (BreakerState, error) {
+	r, err := db.replicaAt(index)
+	if err != nil {
+		return BreakerClosed, err
+	}
+	return r.breaker.state(db.clock.Now(), db.breakerFailures, db.breakerCooldown), nil
+}
+
+// breaker is the circuit breaker of a replica
+type breaker struct {
+	m sync.Mutex
+	// failures is the number of consecutive failed reads
+	failures int
+	// openedAt is when the breaker opened, or when the last probe failed
+	openedAt time.Time
+	// probing is true while a probe read is in flight
+	probing bool
+}
+
+// claim reports whether a read may be routed to the replica: its breaker is closed, or the cooldown
+// is over and no probe is in flight, in which case the read is granted the probe, reported by probe.
+// Checking and granting happen at once, so concurrent reads can't both be granted the probe.
+// A granted probe is given back by report, or by release when the read doesn't try the replica.
+func (b *breaker) claim(now time.Time, threshold int, cooldown time.Duration) (allowed, probe bool) {
+	if threshold <= 0 {
+		return true, false
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	switch {
+	case b.failures < threshold:
+		return true, false
+	case b.probing || now.Sub(b.openedAt) < cooldown:
+		return false, false
+	}
+	b.probing = true
+	return true, true
+}
+
+// release gives back the probe granted by claim to a read which didn't try the replica
+func (b *breaker) release() {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) state(now time.Time, threshold int, cooldown time.Duration) BreakerState {
+	if threshold <= 0 {
+		return BreakerClosed
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	switch {
+	case b.failures < threshold:
+		return BreakerClosed
+	case b.probing || now.Sub(b.openedAt) >= cooldown:
+		return BreakerHalfOpen
+	}
+	return BreakerOpen
+}
+
+// report records the outcome of a read on the replica, probe telling whether the read was the probe
+func (b *breaker) report(now time.Time, threshold int, probe bool, err error) {
+	if threshold <= 0 {
+		return
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if err == nil || !connectionFailure(err) {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= threshold {
+		b.openedAt = now
+	}
+}
+
+// readDone records the outcome of a read on replica r in its circuit breaker
+func (db *DB) readDone(r candidate, err error) {
+	r.breaker.report(db.clock.Now(), db.breakerFailures, r.probe, err)
+}
+
+// releaseProbes gives back the probes granted to the replicas of order, which the read didn't try
+func releaseProbes(order []candidate) {
+	for _, c := range order {
+		if c.probe {
+			c.breaker.release()
+		}
+	}
+}
+
+// closedReplicas filters out the replicas whose circuit breaker is open, unless all of them are.
+// probes tells, by replica index, the replicas whose probe was granted to the read, nil when none was.
+func (db *DB) closedReplicas(replicas []*replica, states []ReplicaState) (closed []ReplicaState, probes []bool) {
+	if db.breakerFailures <= 0 {
+		return states, nil
+	}
+	now := db.clock.Now()
+	closed = make([]ReplicaState, 0, len(states))
+	for _, state := range states {
+		allowed, probe := replicas[state.Index].breaker.claim(now, db.breakerFailures, db.breakerCooldown)
+		if !allowed {
+			continue
+		}
+		closed = append(closed, state)
+		if probe {
+			if probes == nil {
+				probes = make([]bool, len(replicas))
+			}
+			probes[state.Index] = true
+		}
+	}
+	if len(closed) == 0 {
+		return states, nil
+	}
+	return closed, probes
+}
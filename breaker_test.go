@@ -0,0 +1,151 @@
+package mydb
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_CircuitBreaker(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk := newFakeClock()
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2},
+		withClock(clk), WithCircuitBreaker(2, time.Minute))
+	assert.Nil(t, err)
+	// reads go round-robin to replica2 first, then replica1 first, and so on
+	query := func(name string) {
+		_, err := db.Query(name)
+		assert.Nil(t, err)
+	}
+
+	// query failures don't count
+	mock2.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	query("Query1")
+	mock1.ExpectQuery("Query2").WillReturnError(errors.New("syntax error"))
+	mock2.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	query("Query2")
+	state, err := db.BreakerState(0)
+	assert.Nil(t, err)
+	assert.Equal(t, state, BreakerClosed)
+
+	// the breaker of replica1 opens after two connection failures in a row
+	for i := 0; i < 2; i++ {
+		mock2.ExpectQuery("Query3").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+		query("Query3")
+		mock1.ExpectQuery("Query4").WillReturnError(sql.ErrConnDone)
+		mock2.ExpectQuery("Query4").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+		query("Query4")
+	}
+	state, _ = db.BreakerState(0)
+	assert.Equal(t, state, BreakerOpen)
+
+	// replica1 is skipped while open
+	for i := 0; i < 2; i++ {
+		mock2.ExpectQuery("Query5").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+		query("Query5")
+	}
+	assert.Nil(t, mock1.ExpectationsWereMet())
+
+	// once the cooldown is over, a read going to replica2 first sends no probe
+	clk.advance(time.Minute)
+	state, _ = db.BreakerState(0)
+	assert.Equal(t, state, BreakerHalfOpen)
+	mock2.ExpectQuery("Query6").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	query("Query6")
+	state, _ = db.BreakerState(0)
+	assert.Equal(t, state, BreakerHalfOpen)
+
+	// the next read probes replica1, a failure opens the breaker for another cooldown
+	mock1.ExpectQuery("Query7").WillReturnError(sql.ErrConnDone)
+	mock2.ExpectQuery("Query7").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	query("Query7")
+	state, _ = db.BreakerState(0)
+	assert.Equal(t, state, BreakerOpen)
+
+	// a successful probe closes it
+	clk.advance(time.Minute)
+	mock2.ExpectQuery("Query8").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	query("Query8")
+	mock1.ExpectQuery("Query9").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	query("Query9")
+	state, _ = db.BreakerState(0)
+	assert.Equal(t, state, BreakerClosed)
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+
+	_, err = db.BreakerState(2)
+	assert.NotNil(t, err)
+}
+
+func TestDB_CircuitBreakerHalfOpenConcurrent(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk := newFakeClock()
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2},
+		withClock(clk), WithCircuitBreaker(1, time.Minute), WithBalancer(lastReplica{}))
+	assert.Nil(t, err)
+
+	// a refused dial opens the breaker of replica2
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}
+	mock2.ExpectQuery("Query1").WillReturnError(refused)
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query1")
+	assert.Nil(t, err)
+	state, _ := db.BreakerState(1)
+	assert.Equal(t, state, BreakerOpen)
+
+	// once the cooldown is over, a single one of the reads selecting replicas concurrently gets the probe
+	clk.advance(time.Minute)
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	probes := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			order, err := db.readOrder()
+			assert.Nil(t, err)
+			for _, c := range order {
+				if c.index == 1 {
+					assert.True(t, c.probe)
+					m.Lock()
+					probes++
+					m.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, probes, 1)
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
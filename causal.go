@@ -0,0 +1,68 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// tokenPollInterval is how often QueryAfter checks again whether a replica caught up
+const tokenPollInterval = 10 * time.Millisecond
+
+// TokenProvider reports whether replica applied the write identified by token,
+// e.g. a GTID checked with "SELECT GTID_SUBSET(?, @@gtid_executed)" on MySQL
+// or an LSN compared to pg_last_wal_replay_lsn() on Postgres.
+type TokenProvider func(ctx context.Context, replica *sql.DB, token string) (bool, error)
+
+// WithTokenProvider sets the provider used by QueryAfter to find the replicas which caught up
+// with a write, and how long QueryAfter waits for one of them to catch up before reading from master.
+func WithTokenProvider(p TokenProvider, wait time.Duration) Option {
+	return func(db *DB) {
+		db.tokenProvider = p
+		db.tokenWait = wait
+	}
+}
+
+// QueryAfter executes a query on a replica which applied the write identified by token,
+// according to the provider set with WithTokenProvider, so that the read reflects that write.
+// The replicas are checked in the order a read would try them, till one caught up or the wait
+// set with WithTokenProvider elapsed, the query is then executed on master. So is it when no replica
+// can be selected, e.g. every replica is draining or lagging.
+// A replica failing the check counts as not caught up. The query is not failed over, the error
+// of the caught up replica is returned as is.
+//
+// Without a provider the query is executed on master.
+func (db *DB) QueryAfter(ctx context.Context, token string, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx = orBackground(ctx)
+	if db.tokenProvider != nil && !db.readsOnMaster(ctx) {
+		deadline := db.clock.Now().Add(db.tokenWait)
+		for {
+			order, err := db.readOrder()
+			if err != nil {
+				// no replica can serve the read, e.g. every replica is draining
+				break
+			}
+			// checking a token is no read, the probes of the breakers go back to them
+			releaseProbes(order)
+			for _, r := range order {
+				if caughtUp, err := db.tokenProvider(ctx, r.db, token); err == nil && caughtUp {
+					return db.queryOnReplica(ctx, r.index, r.replica, query, args)
+				}
+			}
+			wait := deadline.Sub(db.clock.Now())
+			if wait <= 0 {
+				break
+			}
+			if wait > tokenPollInterval {
+				wait = tokenPollInterval
+			}
+			if !sleep(ctx, db.clock, wait) {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+	return db.QueryContext(WithMaster(ctx), query, args...)
+}
@@ -0,0 +1,62 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_QueryAfter(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := map[*sql.DB]int{replica1: 0, replica2: 0}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2},
+		WithTokenProvider(func(ctx context.Context, replica *sql.DB, token string) (bool, error) {
+			if replica == replica2 {
+				return false, errors.New("permission denied")
+			}
+			applied[replica]++
+			// replica1 catches up on the third check
+			return applied[replica] >= 3, nil
+		}, time.Second))
+	assert.Nil(t, err)
+
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.QueryAfter(context.Background(), "gtid:42", "Query1")
+	assert.Nil(t, err)
+	assert.Equal(t, applied[replica1], 3)
+
+	// no replica catches up in time
+	db.tokenWait = 0
+	applied[replica1] = -10
+	mock.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.QueryAfter(context.Background(), "gtid:43", "Query2")
+	assert.Nil(t, err)
+
+	// every replica is draining
+	db.tokenWait = time.Second
+	assert.Nil(t, db.DrainReplica(replica1))
+	assert.Nil(t, db.DrainReplica(replica2))
+	mock.ExpectQuery("Query3").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.QueryAfter(context.Background(), "gtid:44", "Query3")
+	assert.Nil(t, err)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
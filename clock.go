@@ -0,0 +1,31 @@
+package mydb
+
+import "time"
+
+// clock is the source of time of the health checker, the background loops and the retry backoff,
+// swapped in tests to control time without real sleeps
+type clock interface {
+	Now() time.Time
+	// After returns a channel receiving the time once d elapsed, and a function
+	// releasing the timer when the caller stops waiting before that
+	After(d time.Duration) (<-chan time.Time, func() bool)
+}
+
+// realClock is the clock of the standard library
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) (<-chan time.Time, func() bool) {
+	timer := time.NewTimer(d)
+	return timer.C, timer.Stop
+}
+
+// withClock sets the clock of DB
+func withClock(c clock) Option {
+	return func(db *DB) {
+		db.clock = c
+	}
+}
@@ -0,0 +1,114 @@
+package mydb
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a clock of the tests, whose time only moves when advanced
+type fakeClock struct {
+	m      sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	c := &fakeClock{now: time.Unix(0, 0)}
+	c.cond = sync.NewCond(&c.m)
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) (<-chan time.Time, func() bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	t := &fakeTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	c.cond.Broadcast()
+	return t.c, func() bool {
+		c.m.Lock()
+		defer c.m.Unlock()
+		return c.remove(t)
+	}
+}
+
+// advance moves the time forward by d and fires the timers due
+func (c *fakeClock) advance(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range append([]*fakeTimer(nil), c.timers...) {
+		if !t.at.After(c.now) {
+			c.remove(t)
+			t.c <- c.now
+		}
+	}
+}
+
+// wait blocks till n timers are pending
+func (c *fakeClock) wait(n int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for len(c.timers) != n {
+		c.cond.Wait()
+	}
+}
+
+// remove drops timer t and reports whether it was pending
+func (c *fakeClock) remove(t *fakeTimer) bool {
+	for i := range c.timers {
+		if c.timers[i] == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			c.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+func TestDB_RetryBackoffClock(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk := newFakeClock()
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, withClock(clk), WithRetryPolicy(RetryPolicy{
+		Attempts:  2,
+		BaseDelay: time.Hour,
+		Retryable: func(err error) bool { return err == errFlaky },
+	}))
+	assert.Nil(t, err)
+
+	mock1.ExpectQuery("Query1").WillReturnError(errFlaky)
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	done := make(chan error)
+	go func() {
+		_, err := db.Query("Query1")
+		done <- err
+	}()
+	// the retry waits for the backoff without sleeping for real
+	clk.wait(1)
+	clk.advance(time.Hour)
+	assert.Nil(t, <-done)
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
@@ -0,0 +1,162 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// CloseErrorPolicy tells Close what to do when some nodes fail to close, see WithCloseErrorPolicy.
+type CloseErrorPolicy int
+
+const (
+	// CloseJoinErrors closes every node and returns all the errors joined, it is the default policy
+	CloseJoinErrors CloseErrorPolicy = iota
+	// CloseFirstError closes every node and returns the first error only
+	CloseFirstError
+	// CloseStopOnError stops at the first node failing to close and returns its error,
+	// the nodes after it are left open
+	CloseStopOnError
+	// CloseLogErrors closes every node and logs the errors with the Logger set with WithLogger,
+	// or the standard logger when none is set, Close then returns nil
+	CloseLogErrors
+)
+
+// WithCloseErrorPolicy sets how Close handles the nodes failing to close.
+func WithCloseErrorPolicy(p CloseErrorPolicy) Option {
+	return func(db *DB) {
+		db.closeErrorPolicy = p
+	}
+}
+
+// Close returns the connection to the connection pool.
+// It also stops the background monitors.
+// Master is closed first, then the shard masters and every replica; the errors are handled according to the CloseErrorPolicy.
+// Every error tells the node it comes from and wraps the error of that node.
+func (db *DB) Close() error {
+	db.stopMonitors()
+	db.closeCachedStmts()
+	var errs []error
+	for _, n := range db.closingNodes() {
+		err := n.close()
+		if err == nil {
+			continue
+		}
+		if db.closeErrorPolicy == CloseStopOnError {
+			return err
+		}
+		errs = append(errs, err)
+	}
+	return db.closeErrors(errs)
+}
+
+// CloseContext is like Close, but closes master, the shard masters and the replicas concurrently
+// and returns once they are all closed or ctx is done, e.g. to bound the shutdown time.
+// The nodes still closing when ctx is done fail with the error of ctx, they keep closing in the background.
+// CloseStopOnError can't stop the nodes closing concurrently, the errors are joined then.
+func (db *DB) CloseContext(ctx context.Context) error {
+	ctx = orBackground(ctx)
+	db.stopMonitors()
+	db.closeCachedStmts()
+	nodes := db.closingNodes()
+	done := make(chan int, len(nodes))
+	errs := make([]error, len(nodes))
+	for i, n := range nodes {
+		i, n := i, n
+		go func() {
+			errs[i] = n.close()
+			done <- i
+		}()
+	}
+	closed := make([]bool, len(nodes))
+	for range nodes {
+		select {
+		case i := <-done:
+			closed[i] = true
+		case <-ctx.Done():
+			var failed []error
+			for i, n := range nodes {
+				if !closed[i] {
+					failed = append(failed, n.wrap(ctx.Err()))
+				} else if errs[i] != nil {
+					failed = append(failed, errs[i])
+				}
+			}
+			return db.closeErrors(failed)
+		}
+	}
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return db.closeErrors(failed)
+}
+
+// closingNode is a node closed by Close, wrap tells the node in its errors
+type closingNode struct {
+	db   *sql.DB
+	wrap func(err error) error
+}
+
+// close closes the node and returns its error wrapped
+func (n closingNode) close() error {
+	if err := n.db.Close(); err != nil {
+		return n.wrap(err)
+	}
+	return nil
+}
+
+// closingNodes returns the nodes to close: master, the shard masters, then the replicas
+func (db *DB) closingNodes() []closingNode {
+	nodes := []closingNode{{db: db.master, wrap: func(err error) error {
+		if db.closeErrorPolicy != CloseLogErrors {
+			// the policy logs every error already
+			db.logger.Warn("mydb: master failed to close", "err", err)
+		}
+		return fmt.Errorf(masterCloseFailError, err)
+	}}}
+	for i, m := range db.shardMasters {
+		i := i
+		nodes = append(nodes, closingNode{db: m, wrap: func(err error) error {
+			return fmt.Errorf(shardMasterCloseFailError, i+1, err)
+		}})
+	}
+	for i, r := range db.replicas() {
+		i := i
+		nodes = append(nodes, closingNode{db: r.db, wrap: func(err error) error {
+			return fmt.Errorf(replicaCloseFailError, i+1, err)
+		}})
+	}
+	return nodes
+}
+
+// stopMonitors stops the background monitors before the nodes are closed
+func (db *DB) stopMonitors() {
+	db.StopPoolMonitor()
+	db.StopLagSampler()
+	db.StopHealthCheck()
+}
+
+// closeErrors returns the errors of the nodes which failed to close according to the CloseErrorPolicy
+func (db *DB) closeErrors(errs []error) error {
+	switch {
+	case len(errs) == 0:
+		return nil
+	case db.closeErrorPolicy == CloseFirstError:
+		return errs[0]
+	case db.closeErrorPolicy == CloseLogErrors:
+		for _, err := range errs {
+			if _, ok := db.logger.(nopLogger); ok {
+				log.Printf("mydb: close: %v", err)
+			} else {
+				db.logger.Warn("mydb: close failed", "err", err)
+			}
+		}
+		return nil
+	}
+	return errors.Join(errs...)
+}
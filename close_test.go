@@ -0,0 +1,128 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_CloseErrorPolicy(t *testing.T) {
+	newDB := func(policy ...Option) (*DB, sqlmock.Sqlmock, sqlmock.Sqlmock, sqlmock.Sqlmock) {
+		masterDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		replica1, mock1, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		replica2, mock2, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2}, policy...)
+		assert.Nil(t, err)
+		return db, mock, mock1, mock2
+	}
+	errMaster, errReplica := errors.New("master busy"), errors.New("replica busy")
+
+	// every error is returned by default
+	db, mock, mock1, mock2 := newDB()
+	mock.ExpectClose().WillReturnError(errMaster)
+	mock1.ExpectClose().WillReturnError(errReplica)
+	mock2.ExpectClose()
+	err := db.Close()
+	assert.True(t, errors.Is(err, errMaster))
+	assert.True(t, errors.Is(err, errReplica))
+	assert.Equal(t, err.Error(), "master's db close fail: master busy\nreplica db 1 close fail: replica busy")
+	assert.Nil(t, mock2.ExpectationsWereMet())
+
+	db, mock, mock1, mock2 = newDB(WithCloseErrorPolicy(CloseFirstError))
+	mock.ExpectClose()
+	mock1.ExpectClose().WillReturnError(errReplica)
+	mock2.ExpectClose().WillReturnError(errMaster)
+	err = db.Close()
+	assert.True(t, errors.Is(err, errReplica))
+	assert.Equal(t, err.Error(), "replica db 1 close fail: replica busy")
+	assert.Nil(t, mock2.ExpectationsWereMet())
+
+	// replica2 is left open
+	db, mock, mock1, mock2 = newDB(WithCloseErrorPolicy(CloseStopOnError))
+	mock.ExpectClose()
+	mock1.ExpectClose().WillReturnError(errReplica)
+	mock2.ExpectClose()
+	assert.True(t, errors.Is(db.Close(), errReplica))
+	assert.NotNil(t, mock2.ExpectationsWereMet())
+
+	db, mock, mock1, mock2 = newDB(WithCloseErrorPolicy(CloseLogErrors))
+	mock.ExpectClose().WillReturnError(errMaster)
+	mock1.ExpectClose()
+	mock2.ExpectClose()
+	assert.Nil(t, db.Close())
+}
+
+// stuckConnector opens connections whose Close blocks till release is closed
+type stuckConnector struct {
+	release chan struct{}
+}
+
+func (c stuckConnector) Connect(context.Context) (driver.Conn, error) {
+	return stuckConn{c.release}, nil
+}
+
+func (c stuckConnector) Driver() driver.Driver {
+	return nil
+}
+
+type stuckConn struct {
+	release chan struct{}
+}
+
+func (c stuckConn) Prepare(string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (c stuckConn) Close() error {
+	<-c.release
+	return nil
+}
+
+func (c stuckConn) Begin() (driver.Tx, error) {
+	return nil, driver.ErrSkip
+}
+
+func TestDB_CloseContext(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	defer close(release)
+	replica2 := sql.OpenDB(stuckConnector{release})
+	// an idle connection is closed by Close
+	conn, err := replica2.Conn(context.Background())
+	assert.Nil(t, err)
+	conn.Close()
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+
+	mock.ExpectClose()
+	mock1.ExpectClose().WillReturnError(errors.New("replica busy"))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = db.CloseContext(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, err.Error(), "replica db 1 close fail: replica busy\nreplica db 2 close fail: context deadline exceeded")
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
@@ -0,0 +1,39 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Conn returns a single connection of master, reserved till it is closed.
+// Use it for session-scoped work, e.g. temporary tables or SET statements,
+// whose effects must be seen by the statements following them.
+//
+// The caller must call the connection's Close method to return it to the pool.
+func (db *DB) Conn(ctx context.Context) (*sql.Conn, error) {
+	ctx = orBackground(ctx)
+	conn, err := db.master.Conn(ctx)
+	return conn, db.masterError("conn", err)
+}
+
+// ReplicaConn returns a single connection of a read replica, picked like the replica serving a read,
+// with failover. Use it for a series of reads which must see the same snapshot of a replica,
+// never for writes or session settings which must reach master, use Conn for those.
+//
+// The caller must call the connection's Close method to return it to the pool.
+func (db *DB) ReplicaConn(ctx context.Context) (*sql.Conn, error) {
+	ctx = orBackground(ctx)
+	order, err := db.readOrderFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var conn *sql.Conn
+	res := db.tryReplicas(ctx, order, err, replicaRead{
+		attempt: func(r candidate) error {
+			var err error
+			conn, err = r.db.Conn(ctx)
+			return err
+		},
+	})
+	return conn, res.err
+}
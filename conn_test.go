@@ -0,0 +1,82 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Conn(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2})
+	assert.Nil(t, err)
+
+	conn, err := db.Conn(context.Background())
+	assert.Nil(t, err)
+	mock.ExpectExec("SET search_path").WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = conn.ExecContext(context.Background(), "SET search_path TO app")
+	assert.Nil(t, err)
+	assert.Nil(t, conn.Close())
+
+	// the replica is picked like for reads, failing over a closed one
+	mock2.ExpectClose()
+	assert.Nil(t, replica2.Close())
+	conn, err = db.ReplicaConn(context.Background())
+	assert.Nil(t, err)
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	rows, err := conn.QueryContext(context.Background(), "Query1")
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Close())
+	assert.Nil(t, conn.Close())
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
+func TestDB_ReplicaConnFailover(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failovers []FailoverEvent
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2},
+		WithOnFailover(func(e FailoverEvent) { failovers = append(failovers, e) }))
+	assert.Nil(t, err)
+
+	// replica2 is closed, the connection comes from replica1 and the failover is reported
+	replica2.Close()
+	conn, err := db.ReplicaConn(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, failovers, 1)
+	assert.Equal(t, failovers[0].From, 1)
+	assert.Equal(t, failovers[0].To, 0)
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	rows, err := conn.QueryContext(context.Background(), "Query1")
+	assert.Nil(t, err)
+	rows.Close()
+	assert.Nil(t, conn.Close())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
@@ -0,0 +1,93 @@
+package mydb
+
+import "context"
+
+// contextKey is the type of the keys mydb stores in a context
+type contextKey int
+
+const (
+	noInstrumentationKey contextKey = iota
+	readOnlyExecKey
+	forceMasterKey
+	queryRowStrategyKey
+	replicaAffinityKey
+	routingKeyKey
+)
+
+// WithNoInstrumentation returns a copy of ctx which turns off every hook,
+// metric, log and cache lookup of mydb for the calls made with it.
+// Queries are still routed and executed as usual.
+//
+// It is meant for hot paths where even the hook overhead matters.
+func WithNoInstrumentation(ctx context.Context) context.Context {
+	return context.WithValue(orBackground(ctx), noInstrumentationKey, true)
+}
+
+// instrumented reports whether hooks must be invoked for the call made with ctx
+func instrumented(ctx context.Context) bool {
+	off, _ := ctx.Value(noInstrumentationKey).(bool)
+	return !off
+}
+
+// WithReadOnlyExec returns a copy of ctx which routes the execs made with it
+// to read replicas, with failover, instead of master, unless ctx is returned by WithMaster.
+//
+// It is meant for side-effect-free calls issued through Exec, e.g. read-only
+// stored procedures whose result set is discarded.
+func WithReadOnlyExec(ctx context.Context) context.Context {
+	return context.WithValue(orBackground(ctx), readOnlyExecKey, true)
+}
+
+// readOnlyExec reports whether the exec made with ctx can be served by a read replica
+func readOnlyExec(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(readOnlyExecKey).(bool)
+	return readOnly
+}
+
+// WithMaster returns a copy of ctx which routes the reads and prepares made with it to master,
+// e.g. to read your own writes right after an Exec, which a lagging replica may miss.
+//
+// It takes precedence over every routing to read replicas: read-only transactions begun
+// with it and execs made with a context also returned by WithReadOnlyExec run on master too.
+func WithMaster(ctx context.Context) context.Context {
+	return context.WithValue(orBackground(ctx), forceMasterKey, true)
+}
+
+// forcedMaster reports whether the reads made with ctx must be served by master, see WithMaster
+func forcedMaster(ctx context.Context) bool {
+	forced, _ := ctx.Value(forceMasterKey).(bool)
+	return forced
+}
+
+// QueryRowStrategy is how QueryRow and the like handle a replica failing the query, see WithQueryRowStrategy.
+type QueryRowStrategy int
+
+const (
+	// QueryRowDeferred fails over only the replicas which are unavailable, the error of a query
+	// failing on an available replica is deferred until Row's Scan method is called,
+	// like database/sql does. It is the default strategy.
+	QueryRowDeferred QueryRowStrategy = iota
+	// QueryRowFailover fails over to the next replica whatever the error of the query, like Query does
+	QueryRowFailover
+)
+
+// WithQueryRowStrategy returns a copy of ctx which makes QueryRowContext,
+// QueryRowErr and the like called with it handle failures according to strategy.
+func WithQueryRowStrategy(ctx context.Context, strategy QueryRowStrategy) context.Context {
+	return context.WithValue(orBackground(ctx), queryRowStrategyKey, strategy)
+}
+
+// queryRowStrategy returns the QueryRowStrategy of the call made with ctx
+func queryRowStrategy(ctx context.Context) QueryRowStrategy {
+	strategy, _ := ctx.Value(queryRowStrategyKey).(QueryRowStrategy)
+	return strategy
+}
+
+// orBackground returns ctx, or context.Background() when a nil context is passed by mistake,
+// which would otherwise panic deep in the driver
+func orBackground(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
@@ -0,0 +1,245 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithNoInstrumentation(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hookCalls := 0
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2},
+		WithOnFailover(func(FailoverEvent) { hookCalls++ }),
+		WithOnStmtClose(func(string, time.Duration) { hookCalls++ }),
+	)
+	assert.Nil(t, err)
+	ctx := WithNoInstrumentation(context.Background())
+
+	// failover still happens, but without invoking the hook
+	replica2.Close()
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.QueryContext(ctx, "Query1")
+	assert.Nil(t, err)
+
+	mock1.ExpectPrepare("Select1")
+	stmt, err := db.PrepareStmtContext(ctx, "Select1")
+	assert.Nil(t, err)
+	assert.Nil(t, stmt.Close())
+
+	assert.Equal(t, hookCalls, 0)
+}
+
+func TestWithReadOnlyExec(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+	ctx := WithReadOnlyExec(context.Background())
+
+	// replica2 is picked first and fails over to replica1
+	mock2.ExpectExec("CALL report").WillReturnError(sql.ErrConnDone)
+	mock1.ExpectExec("CALL report").WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = db.ExecContext(ctx, "CALL report")
+	assert.Nil(t, err)
+	// other execs stay on master
+	mock.ExpectExec("Insert1").WillReturnResult(sqlmock.NewResult(1, 1))
+	_, err = db.ExecContext(context.Background(), "Insert1")
+	assert.Nil(t, err)
+	// so do the ones forced to master
+	mock.ExpectExec("CALL report").WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = db.ExecContext(WithMaster(ctx), "CALL report")
+	assert.Nil(t, err)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
+func TestWithMaster(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1)
+	assert.Nil(t, err)
+	ctx := WithMaster(context.Background())
+
+	mock.ExpectExec("Insert1").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	_, err = db.ExecContext(ctx, "Insert1")
+	assert.Nil(t, err)
+	_, err = db.QueryContext(ctx, "Query1")
+	assert.Nil(t, err)
+	var id int
+	assert.Nil(t, db.QueryRowContext(ctx, "Query2").Scan(&id))
+	// other reads still go to replicas
+	mock1.ExpectQuery("Query3").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err = db.QueryContext(context.Background(), "Query3")
+	assert.Nil(t, err)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
+
+func TestWithQueryRowStrategy(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2})
+	assert.Nil(t, err)
+	var id int
+
+	// deferred by default, an unavailable replica is failed over
+	mock2.ExpectQuery("Query1").WillReturnError(sql.ErrConnDone)
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	assert.Nil(t, db.QueryRowContext(context.Background(), "Query1").Scan(&id))
+	assert.Equal(t, id, 1)
+	// but the error of the query is reported by Scan
+	mock1.ExpectQuery("Query1").WillReturnError(errors.New("syntax error"))
+	assert.Equal(t, db.QueryRowContext(context.Background(), "Query1").Scan(&id).Error(), "syntax error")
+
+	// failover whatever the error
+	ctx := WithQueryRowStrategy(context.Background(), QueryRowFailover)
+	mock2.ExpectQuery("Query2").WillReturnError(errors.New("syntax error"))
+	mock1.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	assert.Nil(t, db.QueryRowContext(ctx, "Query2").Scan(&id))
+	assert.Equal(t, id, 2)
+
+	mock2.ExpectQuery("Query3").WillReturnError(sql.ErrConnDone)
+	mock1.ExpectQuery("Query3").WillReturnError(sql.ErrConnDone)
+	_, err = db.QueryRowErr(ctx, "Query3")
+	assert.True(t, errors.Is(err, ErrNoReplicaAvailable))
+
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
+func TestDB_QueryRowDialError(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2}, WithBalancer(lastReplica{}))
+	assert.Nil(t, err)
+
+	// replica2 refuses the connection, the read fails over to replica1
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}
+	mock2.ExpectQuery("Query1").WillReturnError(refused)
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	row, err := db.QueryRowErr(context.Background(), "Query1")
+	assert.Nil(t, err)
+	var id int
+	assert.Nil(t, row.Scan(&id))
+	assert.Equal(t, id, 1)
+
+	// so does a timeout
+	timeout := &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	mock2.ExpectQuery("Query2").WillReturnError(timeout)
+	mock1.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	_, err = db.QueryRowErr(context.Background(), "Query2")
+	assert.Nil(t, err)
+
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+	assert.True(t, connectionFailure(syscall.EHOSTUNREACH))
+	assert.False(t, connectionFailure(context.DeadlineExceeded))
+}
+
+func TestDB_NilContext(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1)
+	assert.Nil(t, err)
+	var ctx context.Context
+
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	rows, err := db.QueryContext(ctx, "Query1")
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Close())
+
+	mock1.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	var id int
+	assert.Nil(t, db.QueryRowContext(ctx, "Query2").Scan(&id))
+
+	mock.ExpectExec("Insert").WillReturnResult(sqlmock.NewResult(1, 1))
+	_, err = db.ExecContext(ctx, "Insert")
+	assert.Nil(t, err)
+
+	mock.ExpectPrepare("Update")
+	_, err = db.PrepareContext(ctx, "Update")
+	assert.Nil(t, err)
+
+	mock.ExpectBegin()
+	_, err = db.BeginTx(ctx, nil)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.PingContext(ctx))
+
+	// the contexts of mydb derive from a nil ctx too
+	assert.False(t, instrumented(WithNoInstrumentation(ctx)))
+	assert.True(t, readOnlyExec(WithReadOnlyExec(ctx)))
+	assert.True(t, forcedMaster(WithMaster(ctx)))
+	assert.Equal(t, queryRowStrategy(WithQueryRowStrategy(ctx, QueryRowFailover)), QueryRowFailover)
+	_, keyed := routingKeyOf(WithRoutingKey(ctx, "user-42"))
+	assert.True(t, keyed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
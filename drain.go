@@ -0,0 +1,53 @@
+package mydb
+
+import (
+	"database/sql"
+	"sync/atomic"
+)
+
+// DrainReplica stops routing new reads to r, e.g. before a maintenance, without removing or closing it:
+// the reads already running on r finish normally. Draining takes precedence over the health check,
+// a draining replica is skipped even when it is up, and reads fail with ErrNoReplicaAvailable
+// when every replica is draining. UndrainReplica routes reads to r again.
+func (db *DB) DrainReplica(r *sql.DB) error {
+	return db.setDraining(r, true)
+}
+
+// UndrainReplica routes reads again to r, drained with DrainReplica.
+func (db *DB) UndrainReplica(r *sql.DB) error {
+	return db.setDraining(r, false)
+}
+
+// setDraining marks the replica r draining or not
+func (db *DB) setDraining(r *sql.DB, draining bool) error {
+	var state int32
+	if draining {
+		state = 1
+	}
+	for _, replica := range db.replicas() {
+		if replica.db == r {
+			atomic.StoreInt32(&replica.draining, state)
+			return nil
+		}
+	}
+	return ErrReplicaNotFound
+}
+
+// isDraining reports whether the replica is drained with DrainReplica
+func (r *replica) isDraining() bool {
+	return atomic.LoadInt32(&r.draining) == 1
+}
+
+// undrainedReplicas filters out the draining replicas
+func undrainedReplicas(replicas []*replica, states []ReplicaState) ([]ReplicaState, error) {
+	undrained := make([]ReplicaState, 0, len(states))
+	for _, state := range states {
+		if !replicas[state.Index].isDraining() {
+			undrained = append(undrained, state)
+		}
+	}
+	if len(undrained) == 0 {
+		return nil, ErrNoReplicaAvailable
+	}
+	return undrained, nil
+}
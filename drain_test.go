@@ -0,0 +1,48 @@
+package mydb
+
+import (
+	"database/sql"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_DrainReplica(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2})
+	assert.Nil(t, err)
+
+	// draining wins over the health check, even when replica1 is down
+	assert.Nil(t, db.DrainReplica(replica2))
+	db.readreplicas[0].setDown(true)
+	for i := 0; i < 2; i++ {
+		mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+		_, err = db.Query("Query1")
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, db.DrainReplica(replica1))
+	_, err = db.Query("Query2")
+	assert.Equal(t, err, ErrNoReplicaAvailable)
+
+	assert.Nil(t, db.UndrainReplica(replica2))
+	mock2.ExpectQuery("Query3").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query3")
+	assert.Nil(t, err)
+
+	assert.Equal(t, db.DrainReplica(masterDB), ErrReplicaNotFound)
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
@@ -1,9 +1,147 @@
 package mydb
 
+import (
+	"errors"
+	"fmt"
+)
+
 const (
-	noReadReplicaError      = "Provide at least one read replica"
-	replicaPingFailError    = "replica db %d ping fail: %s"
-	masterPingFailError     = "master's db ping fail: %s"
-	pingChannelCloseError   = "Ping Channel is closed"
-	noReplicaAvailableError = "No replica is alive for reading data"
+	noReadReplicaError            = "Provide at least one read replica"
+	replicaPingFailError          = "replica db %d ping fail: %s"
+	replicaReadFailError          = "replica db %d read fail: %s"
+	masterPingFailError           = "master's db ping fail: %w"
+	noReplicaAvailableError       = "No replica is alive for reading data"
+	scriptStatementFailError      = "statement %d of script failed: %s"
+	masterNotWritableError        = "master db is not writable: %w"
+	replicaLagFailError           = "replica db %d lag measurement fail: %s"
+	writeOnReadPathError          = "statement is not a read and can't be sent to a read replica"
+	replicaIndexOutOfRangeError   = "replica index %d is out of range, %d replicas are configured"
+	masterOperationFailError      = "master %s failed: %w"
+	masterCloseFailError          = "master's db close fail: %w"
+	replicaCloseFailError         = "replica db %d close fail: %w"
+	shardMasterCloseFailError     = "shard master db %d close fail: %w"
+	shardMasterPingFailError      = "shard master db %d ping fail: %w"
+	nilShardMasterError           = "shard master db %d is nil: %w"
+	nilReplicaError               = "replica db must not be nil"
+	nilReplicaAtError             = "replica db %d is nil: %w"
+	nilMasterError                = "master db must not be nil"
+	stdlibOpenError               = "the driver of StdlibDB can't be opened by name"
+	replicaWritableError          = "replica db %d is writable"
+	replicaReadOnlyCheckFailError = "replica db %d read-only check fail: %w"
+	noReadOnlyProbeError          = "no read-only probe is set, see WithReplicaReadOnlyCheck"
+	emptyStmtNameError            = "statement name must not be empty"
+	stmtRegisteredError           = "a statement is already registered as %q"
+	unknownStmtError              = "no statement is registered as %q"
+	replicaNotFoundError          = "replica db is not part of the read replicas"
+	lastReplicaError              = "the last read replica can't be removed"
+	replicaWarmupFailError        = "replica db %d prepare of %q fail: %w"
+	queryTooLongError             = "query is longer than the maximum query length"
+	allReplicasLaggingError       = "All replicas are lagging behind master more than allowed"
+	unknownReplicaNameError       = "no replica is named %q"
+	stmtCacheDisabledError        = "no replica caches statements, see WithStmtCache"
+)
+
+var (
+	// ErrNoReadReplica is returned by the constructors when no read replica is given
+	ErrNoReadReplica = errors.New(noReadReplicaError)
+	// ErrNoReplicaAvailable is returned when no replica could serve a read, match it with errors.Is:
+	// a read which failed on the replicas of a replica set of several returns a *NoReplicaAvailableError
+	ErrNoReplicaAvailable = errors.New(noReplicaAvailableError)
+	// ErrNilReplica is returned by AddReplica when given a nil replica,
+	// and wrapped by the constructors when one of the replicas is nil
+	ErrNilReplica = errors.New(nilReplicaError)
+	// ErrNilMaster is returned by the constructors when master is nil,
+	// and wrapped when one of the masters given to WithShardMasters is nil
+	ErrNilMaster = errors.New(nilMasterError)
+	// ErrReplicaNotFound is returned by RemoveReplica when given a replica which is not part of the DB
+	ErrReplicaNotFound = errors.New(replicaNotFoundError)
+	// ErrLastReplica is returned by RemoveReplica when asked to remove the only replica left
+	ErrLastReplica = errors.New(lastReplicaError)
+	// ErrWriteOnReadPath is returned when a statement which is not a read is issued
+	// through the read path while WithRejectWritesOnRead is enabled
+	ErrWriteOnReadPath = errors.New(writeOnReadPathError)
+	// ErrWriteOnReplica is an alias of ErrWriteOnReadPath, also returned by ExecOnAllReplicas
+	// for the statements modifying rows
+	ErrWriteOnReplica = ErrWriteOnReadPath
+	// ErrQueryTooLong is returned when a query is longer than allowed by WithMaxQueryLength
+	ErrQueryTooLong = errors.New(queryTooLongError)
+	// ErrNoReadOnlyProbe is returned by VerifyReadOnly when WithReplicaReadOnlyCheck is not used
+	ErrNoReadOnlyProbe = errors.New(noReadOnlyProbeError)
+	// ErrEmptyStmtName is returned by Register when given an empty name
+	ErrEmptyStmtName = errors.New(emptyStmtNameError)
+	// ErrAllReplicasLagging is returned when every replica lags more than allowed by WithFreshRoundRobin
+	ErrAllReplicasLagging = errors.New(allReplicasLaggingError)
+	// ErrStmtCacheDisabled is returned by WarmupStatements when no replica has a statement cache
+	ErrStmtCacheDisabled = errors.New(stmtCacheDisabledError)
 )
+
+// ReplicaPingError is the error of a replica returned by PingContext.
+type ReplicaPingError struct {
+	// Index is the position of the replica, in the order passed to New
+	Index int
+	Err   error
+}
+
+func (e *ReplicaPingError) Error() string {
+	return fmt.Sprintf(replicaPingFailError, e.Index+1, e.Err.Error())
+}
+
+// Unwrap returns the error of the replica ping
+func (e *ReplicaPingError) Unwrap() error {
+	return e.Err
+}
+
+// ReplicaError is the error of a replica a read failed on.
+type ReplicaError struct {
+	// Index is the position of the replica, in the order passed to New
+	Index int
+	Err   error
+}
+
+func (e *ReplicaError) Error() string {
+	return fmt.Sprintf(replicaReadFailError, e.Index+1, e.Err.Error())
+}
+
+// Unwrap returns the error of the replica
+func (e *ReplicaError) Unwrap() error {
+	return e.Err
+}
+
+// NoReplicaAvailableError is returned when a read failed on the replicas it tried,
+// unless the replica set has a single replica, whose error is returned as is.
+// Its message is the one of ErrNoReplicaAvailable, which errors.Is matches,
+// and it unwraps to the *ReplicaError of every replica tried, in the order they were tried.
+type NoReplicaAvailableError struct {
+	Errs []error
+}
+
+func (e *NoReplicaAvailableError) Error() string {
+	return noReplicaAvailableError
+}
+
+// Unwrap returns the errors of the replicas tried
+func (e *NoReplicaAvailableError) Unwrap() []error {
+	return e.Errs
+}
+
+// Is reports whether target is ErrNoReplicaAvailable
+func (e *NoReplicaAvailableError) Is(target error) bool {
+	return target == ErrNoReplicaAvailable
+}
+
+// WithErrorContext makes the errors returned by master, for exec, begin and prepare,
+// prefixed with the failed operation, e.g. "master exec failed: <driver error>",
+// the same way replica ping errors are. errors.Unwrap returns the driver error.
+func WithErrorContext(enabled bool) Option {
+	return func(db *DB) {
+		db.errorContext = enabled
+	}
+}
+
+// masterError adds the error context to err returned by master for operation op
+func (db *DB) masterError(op string, err error) error {
+	if err == nil || !db.errorContext {
+		return err
+	}
+	return fmt.Errorf(masterOperationFailError, op, err)
+}
@@ -0,0 +1,102 @@
+package mydb
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_WithErrorContext(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithErrorContext(true))
+	assert.Nil(t, err)
+
+	driverErr := errors.New("duplicate key")
+	mock.ExpectExec("Insert").WillReturnError(driverErr)
+	_, err = db.Exec("Insert")
+	assert.Equal(t, err.Error(), "master exec failed: duplicate key")
+	assert.Equal(t, errors.Unwrap(err), driverErr)
+
+	mock.ExpectBegin().WillReturnError(driverErr)
+	_, err = db.Begin()
+	assert.Equal(t, err.Error(), "master begin failed: duplicate key")
+
+	mock.ExpectPrepare("Update").WillReturnError(driverErr)
+	_, err = db.Prepare("Update")
+	assert.Equal(t, err.Error(), "master prepare failed: duplicate key")
+	assert.True(t, errors.Is(err, driverErr))
+
+	// successful calls are untouched
+	mock.ExpectExec("Insert").WillReturnResult(sqlmock.NewResult(1, 1))
+	_, err = db.Exec("Insert")
+	assert.Nil(t, err)
+
+	// disabled by default
+	db, err = New(masterDB, replica1)
+	assert.Nil(t, err)
+	mock.ExpectExec("Insert").WillReturnError(driverErr)
+	_, err = db.Exec("Insert")
+	assert.Equal(t, err, driverErr)
+}
+
+func TestTypedErrors(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = New(masterDB)
+	assert.True(t, errors.Is(err, ErrNoReadReplica))
+
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+	replica2.Close()
+	err = db.Ping()
+	var pingErr *ReplicaPingError
+	assert.True(t, errors.As(err, &pingErr))
+	assert.Equal(t, pingErr.Index, 1)
+	assert.Equal(t, pingErr.Error(), "replica db 2 ping fail: sql: database is closed")
+
+	replica1.Close()
+	_, err = db.Query("Query1")
+	assert.True(t, errors.Is(err, ErrNoReplicaAvailable))
+
+	// a single replica tried, the other one being marked down, still matches
+	replica3, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica4, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err = New(masterDB, replica3, replica4)
+	assert.Nil(t, err)
+	db.readreplicas[0].setDown(true)
+	replica4.Close()
+	_, err = db.Query("Query1")
+	assert.True(t, errors.Is(err, ErrNoReplicaAvailable))
+
+	// the error of a lone replica is returned as is
+	db, err = New(masterDB, replica4)
+	assert.Nil(t, err)
+	_, err = db.Query("Query1")
+	assert.Equal(t, err.Error(), "sql: database is closed")
+}
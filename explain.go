@@ -0,0 +1,21 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// ExplainContext executes "EXPLAIN " followed by query on the read replica the query would be
+// routed to, with failover, and returns the plan rows, whose columns depend on the database.
+// Use a context returned by WithReplicaAffinity to then run the query itself on the replica
+// which explained it:
+//
+//	ctx = mydb.WithReplicaAffinity(ctx)
+//	plan, err := db.ExplainContext(ctx, query, args...)
+//	...
+//	rows, err := db.QueryContext(ctx, query, args...)
+func (db *DB) ExplainContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx = orBackground(ctx)
+	rows, _, err := db.query(ctx, "EXPLAIN "+query, args)
+	return rows, err
+}
@@ -0,0 +1,45 @@
+package mydb
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_ExplainContext(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+
+	// the query follows the explain on replica2 instead of moving on to replica1
+	ctx := WithReplicaAffinity(context.Background())
+	mock2.ExpectQuery(regexp.QuoteMeta("EXPLAIN SELECT name FROM users WHERE id = ?")).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "select_type"}).AddRow(1, "SIMPLE"))
+	mock2.ExpectQuery(regexp.QuoteMeta("SELECT name FROM users WHERE id = ?")).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+	plan, err := db.ExplainContext(ctx, "SELECT name FROM users WHERE id = ?", 1)
+	assert.Nil(t, err)
+	columns, err := plan.Columns()
+	assert.Nil(t, err)
+	assert.Equal(t, columns, []string{"id", "select_type"})
+	plan.Close()
+	_, err = db.QueryContext(ctx, "SELECT name FROM users WHERE id = ?", 1)
+	assert.Nil(t, err)
+
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
@@ -0,0 +1,86 @@
+package mydb
+
+import "context"
+
+// replicaRead is a call tried on the read replicas one after the other, see tryReplicas
+type replicaRead struct {
+	// query and args are the ones reported to the failover hooks, empty for calls without a query
+	query string
+	args  []interface{}
+	// attempt runs the call on replica r
+	attempt func(r candidate) error
+	// final reports whether err, returned by attempt, ends the call without failing over,
+	// e.g. the error of a query failing on a replica which is up. nil fails over every error.
+	final func(err error) bool
+	// fallback lets the call fall back to master, see masterFallback
+	fallback bool
+	// unreachable makes a single unreachable replica match ErrNoReplicaAvailable too, see failures.unavailable
+	unreachable bool
+}
+
+// readResult is the outcome of a call tried on the read replicas
+type readResult struct {
+	// served is the replica which served the call, set when err is nil
+	served candidate
+	// failedOver is set when served is not the first replica the call went to
+	failedOver bool
+	// err is the error of the call
+	err error
+	// node is the node whose error err is, when the call stopped on a final error
+	node string
+	// fallback is set when the call failed on the replicas and must be retried on master
+	fallback bool
+}
+
+// tryReplicas runs read on the replicas of order one after the other till one serves it.
+// err is the error of the selection of order, a read falls back to master with it when no replica is eligible.
+//
+// Every failover withdraws from the retry budget and is reported to the hooks, every replica
+// tried is retried according to the retry policy and reports to its circuit breaker.
+// The call stops once ctx is done, with the error of ctx and without falling back to master:
+// the caller gave up, trying the next replicas would only add load.
+func (db *DB) tryReplicas(ctx context.Context, order []candidate, err error, read replicaRead) readResult {
+	failed := failures{replicas: len(db.replicas())}
+	tried := 0
+	// the probes granted to the replicas the call didn't reach go back to their breakers
+	defer func() {
+		releaseProbes(order[tried:])
+	}()
+	for n, r := range order {
+		if err := ctx.Err(); err != nil {
+			return readResult{err: err}
+		}
+		if n > 0 {
+			if !db.retryBudget.withdraw() {
+				break
+			}
+			db.failover(ctx, order[n-1].index, r.index, err, read.query, read.args)
+		}
+		tried = n + 1
+		err = db.retry(ctx, func() error {
+			return read.attempt(r)
+		})
+		db.readDone(r, err)
+		if err == nil {
+			db.readServed(ctx, r)
+			return readResult{served: r, failedOver: n > 0}
+		}
+		if read.final != nil && read.final(err) {
+			return readResult{err: err, node: replicaNode(r.index), fallback: read.fallback && db.masterFallback(ctx, read.query, err)}
+		}
+		if failed.add(r.index, err) {
+			break
+		}
+	}
+	if !failed.systemic && instrumented(ctx) {
+		// the replicas are down rather than the query failing everywhere
+		db.logger.Warn("mydb: no replica could serve the read", "query", read.query, "tried", len(failed.errs), "err", err)
+	}
+	if read.fallback && db.masterFallback(ctx, read.query, err) {
+		return readResult{err: err, fallback: true}
+	}
+	if read.unreachable {
+		return readResult{err: failed.unavailable()}
+	}
+	return readResult{err: failed.err()}
+}
@@ -0,0 +1,78 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// errDBClosedMessage is the message of the unexported error database/sql returns once a sql.DB is closed
+const errDBClosedMessage = "sql: database is closed"
+
+// failures tracks the errors of the replicas a read failed on, to tell a replica being down
+// from a query failing the same way everywhere, e.g. on a table missing from every replica.
+type failures struct {
+	// replicas is the number of replicas of the replica set
+	replicas int
+	last     error
+	systemic bool
+	// errs are the errors of the replicas the read failed on
+	errs []error
+}
+
+// add records err of the replica at index and reports whether failing over must stop,
+// which is the case when err repeats the previous failure
+func (f *failures) add(index int, err error) bool {
+	f.systemic = f.last != nil && sameFailure(f.last, err)
+	f.last = err
+	f.errs = append(f.errs, &ReplicaError{Index: index, Err: err})
+	return f.systemic
+}
+
+// err returns the error of a read which failed on the replicas it tried.
+// The underlying error is returned when the read failed the same way everywhere,
+// or when the replica set has a single replica, a *NoReplicaAvailableError otherwise,
+// even when a single replica was tried, e.g. the others being skipped or the retry budget exhausted.
+func (f *failures) err() error {
+	if f.last != nil && (f.systemic || f.replicas == 1) {
+		return f.last
+	}
+	return &NoReplicaAvailableError{Errs: f.errs}
+}
+
+// unavailable is err, except that the error of a single replica which could not be reached
+// is wrapped in a *NoReplicaAvailableError, for the calls whose unreachable replicas must
+// match ErrNoReplicaAvailable whatever their number
+func (f *failures) unavailable() error {
+	if len(f.errs) == 1 && connectionFailure(f.last) {
+		return &NoReplicaAvailableError{Errs: f.errs}
+	}
+	return f.err()
+}
+
+// sameFailure reports whether a and b are the same failure of the query itself.
+// Connection failures are never the same, another replica may well be up.
+func sameFailure(a, b error) bool {
+	if connectionFailure(a) || connectionFailure(b) {
+		return false
+	}
+	return fmt.Sprintf("%T", a) == fmt.Sprintf("%T", b) && a.Error() == b.Error()
+}
+
+// connectionFailure reports whether err tells the node can't be reached rather than the query failed:
+// a broken or closed connection, or a network error such as a refused dial or a timeout.
+// The deadline of the caller's context is not the node's failure.
+func connectionFailure(err error) bool {
+	if isTransient(err) || errors.Is(err, sql.ErrConnDone) || err.Error() == errDBClosedMessage {
+		return true
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ETIMEDOUT)
+}
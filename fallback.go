@@ -0,0 +1,41 @@
+package mydb
+
+import "context"
+
+// WithMasterReadFallback makes reads which failed on every replica retry on master
+// before giving up, so that a healthy master keeps the read path up.
+// It is disabled by default, reads then fail once every replica failed.
+// It is a shorthand for WithReadPreference, enabled being PreferReplica and disabled ReplicaOnly.
+//
+// QueryRowContext also falls back when the query failed on an available replica.
+func WithMasterReadFallback(enabled bool) Option {
+	if enabled {
+		return WithReadPreference(PreferReplica)
+	}
+	return WithReadPreference(ReplicaOnly)
+}
+
+// WithOnMasterFallback registers a hook invoked every time a read falls back to master,
+// err is the error of the last replica tried. It lets callers alert on the degraded mode.
+func WithOnMasterFallback(fn func(ctx context.Context, query string, err error)) Option {
+	return func(db *DB) {
+		db.onMasterFallback = fn
+	}
+}
+
+// lagFallback reports whether a read failing to select a replica with err falls back to master,
+// which is the case when every replica lags too much and the reads prefer replicas
+func (db *DB) lagFallback(err error) bool {
+	return err == ErrAllReplicasLagging && db.readPreference == PreferReplica
+}
+
+// masterFallback reports whether a read which failed on replicas with err must be retried on master
+func (db *DB) masterFallback(ctx context.Context, query string, err error) bool {
+	if db.readPreference != PreferReplica {
+		return false
+	}
+	if db.onMasterFallback != nil && instrumented(ctx) {
+		db.onMasterFallback(ctx, query, err)
+	}
+	return true
+}
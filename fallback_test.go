@@ -0,0 +1,65 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_MasterReadFallback(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fallbacks []string
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2},
+		WithMasterReadFallback(true),
+		WithOnMasterFallback(func(ctx context.Context, query string, err error) {
+			fallbacks = append(fallbacks, query+": "+err.Error())
+		}),
+	)
+	assert.Nil(t, err)
+
+	mock2.ExpectQuery("Query1").WillReturnError(errors.New("down"))
+	mock1.ExpectQuery("Query1").WillReturnError(errors.New("down"))
+	mock.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query1")
+	assert.Nil(t, err)
+
+	mock1.ExpectQuery("Query2").WillReturnError(errors.New("down"))
+	mock.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}).AddRow(1))
+	var col1 int
+	assert.Nil(t, db.QueryRow("Query2").Scan(&col1))
+	assert.Equal(t, col1, 1)
+
+	mock2.ExpectPrepare("Select1").WillReturnError(errors.New("down"))
+	mock1.ExpectPrepare("Select1").WillReturnError(errors.New("down"))
+	mock.ExpectPrepare("Select1")
+	stmt, err := db.PrepareStmt("Select1")
+	assert.Nil(t, err)
+	assert.Equal(t, stmt.Node(), masterNode)
+
+	assert.Equal(t, fallbacks, []string{"Query1: down", "Query2: down", "Select1: down"})
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+
+	// disabled by default
+	db, err = New(masterDB, replica1)
+	assert.Nil(t, err)
+	mock1.ExpectQuery("Query3").WillReturnError(errors.New("down"))
+	_, err = db.Query("Query3")
+	assert.Equal(t, err.Error(), "down")
+}
@@ -1,9 +1,15 @@
 module github.com/rosspatil/sql-db-mocking
 
-go 1.12
+go 1.20
 
 require (
 	github.com/DATA-DOG/go-sqlmock v1.3.3
 	github.com/golang/mock v1.3.1
 	github.com/stretchr/testify v1.4.0
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
+)
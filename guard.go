@@ -0,0 +1,255 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+)
+
+// WithRejectWritesOnRead makes the read path (Query, QueryRow and their variants)
+// reject statements which are not reads with ErrWriteOnReadPath, instead of sending
+// them to a read replica. Reads are classified with IsReadQuery, see WithQueryClassifier.
+//
+// QueryRow can't return the error, its Scan reports it instead. Use QueryRowErr to get it eagerly.
+func WithRejectWritesOnRead(reject bool) Option {
+	return func(db *DB) {
+		db.rejectWritesOnRead = reject
+	}
+}
+
+// WithQueryClassifier replaces IsReadQuery with isRead to tell reads from writes, e.g. to encode the
+// read-only stored procedures or dialect specific statements of a database. It routes PrepareContext
+// and, with WithRejectWritesOnRead, guards the read path. A nil isRead keeps IsReadQuery.
+func WithQueryClassifier(isRead func(query string) bool) Option {
+	return func(db *DB) {
+		db.isRead = isRead
+	}
+}
+
+// isReadQuery classifies query with the classifier set with WithQueryClassifier, IsReadQuery by default
+func (db *DB) isReadQuery(query string) bool {
+	if db.isRead != nil {
+		return db.isRead(query)
+	}
+	return IsReadQuery(query)
+}
+
+// Classify reports where PrepareContext would route query without executing anything,
+// "master" or "replica", and whether the classifier, see WithQueryClassifier, deems it a read,
+// e.g. to audit the routing of a corpus of queries in CI. Reads target master with the MasterOnly read preference.
+func (db *DB) Classify(query string) (target string, isRead bool) {
+	isRead = db.isReadQuery(query)
+	if !isRead || db.readPreference == MasterOnly {
+		return masterNode, isRead
+	}
+	return "replica", isRead
+}
+
+// IsReadQuery reports whether query only retrieves data, so it can be served by a read replica.
+// It is the default classifier used to route PrepareContext and, with WithRejectWritesOnRead, to guard the read path.
+//
+// Leading comments and parentheses are skipped, then SELECT, SHOW and TABLE statements,
+// WITH common table expressions followed by a SELECT, and EXPLAIN of any of them are reads.
+// Everything else, e.g. INSERT, UPDATE, DELETE or CALL, is not.
+// A query made of several statements is a read only when every statement is.
+func IsReadQuery(query string) bool {
+	reads := 0
+	for _, statement := range splitStatements(query) {
+		if skipComments(statement) == "" {
+			continue
+		}
+		if !isReadStatement(statement) {
+			return false
+		}
+		reads++
+	}
+	return reads > 0
+}
+
+// isReadStatement reports whether a single statement only retrieves data
+func isReadStatement(query string) bool {
+	query = strings.TrimLeft(skipComments(strings.ToLower(query)), "( \t\r\n")
+	if strings.HasPrefix(query, "select") {
+		// matched as a prefix, as it always was
+		return true
+	}
+	verb, rest := firstWord(query)
+	switch verb {
+	case "show", "table":
+		return true
+	case "with":
+		return cteStatement(rest) == "select"
+	case "explain":
+		return isReadStatement(skipExplainOptions(rest))
+	}
+	return false
+}
+
+// skipComments returns query without its leading whitespaces, line comments and block comments
+func skipComments(query string) string {
+	for {
+		query = strings.TrimSpace(query)
+		switch {
+		case strings.HasPrefix(query, "--"):
+			end := strings.IndexByte(query, '\n')
+			if end < 0 {
+				return ""
+			}
+			query = query[end+1:]
+		case strings.HasPrefix(query, "/*"):
+			end := strings.Index(query, "*/")
+			if end < 0 {
+				return ""
+			}
+			query = query[end+2:]
+		default:
+			return query
+		}
+	}
+}
+
+// isDataModification reports whether a statement of query modifies rows,
+// i.e. is an INSERT, UPDATE, DELETE, REPLACE or MERGE, possibly following common table expressions
+func isDataModification(query string) bool {
+	for _, statement := range splitStatements(query) {
+		verb, rest := firstWord(strings.TrimLeft(skipComments(strings.ToLower(statement)), "( \t\r\n"))
+		if verb == "with" {
+			verb = cteStatement(rest)
+		}
+		switch verb {
+		case "insert", "update", "delete", "replace", "merge":
+			return true
+		}
+	}
+	return false
+}
+
+// firstWord splits query into its first word and the rest
+func firstWord(query string) (string, string) {
+	end := 0
+	for end < len(query) && isWordByte(query[end]) {
+		end++
+	}
+	return query[:end], query[end:]
+}
+
+// skipExplainOptions returns the statement explained by a lowercase EXPLAIN, stripped of the EXPLAIN keyword,
+// e.g. "select 1" for " (analyze, buffers) select 1" or " format=json select 1"
+func skipExplainOptions(query string) string {
+	for {
+		query = strings.TrimSpace(query)
+		if strings.HasPrefix(query, "(") {
+			end := strings.IndexByte(query, ')')
+			if end < 0 {
+				return ""
+			}
+			query = query[end+1:]
+			continue
+		}
+		word, rest := firstWord(query)
+		rest = strings.TrimSpace(rest)
+		switch {
+		case word == "":
+			// not an option, e.g. a quote
+			return query
+		case strings.HasPrefix(rest, "="):
+			// an option with a value, e.g. format=json
+			_, rest = firstWord(strings.TrimSpace(rest[1:]))
+		case word == "analyze" || word == "analyse" || word == "verbose" || word == "extended" ||
+			word == "partitions" || word == "query" || word == "plan":
+		default:
+			return query
+		}
+		query = rest
+	}
+}
+
+// cteStatement returns the verb of the statement following the common table expressions
+// of a lowercase query stripped of its leading WITH, e.g. "select" or "delete".
+func cteStatement(query string) string {
+	depth := 0
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(query) && query[i] != c; i++ {
+			}
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && isWordByte(c):
+			end := i
+			for end < len(query) && isWordByte(query[end]) {
+				end++
+			}
+			switch word := query[i:end]; word {
+			case "select", "insert", "update", "delete", "merge":
+				return word
+			}
+			i = end - 1
+		}
+	}
+	return ""
+}
+
+// isWordByte reports whether c can be part of an SQL keyword or identifier
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// WithMaxQueryLength makes queries, execs and prepares longer than n bytes fail with ErrQueryTooLong
+// before reaching any node. Such queries are usually the sign of a bug, e.g. an unbounded IN list.
+// The length is unlimited by default.
+func WithMaxQueryLength(n int) Option {
+	return func(db *DB) {
+		db.maxQueryLength = n
+	}
+}
+
+// checkLength returns ErrQueryTooLong when query is longer than allowed by WithMaxQueryLength
+func (db *DB) checkLength(query string) error {
+	if db.maxQueryLength > 0 && len(query) > db.maxQueryLength {
+		return ErrQueryTooLong
+	}
+	return nil
+}
+
+// checkReadPath returns ErrWriteOnReadPath when query must not be sent to a read replica
+func (db *DB) checkReadPath(query string) error {
+	if db.rejectWritesOnRead && !db.isReadQuery(query) {
+		return ErrWriteOnReadPath
+	}
+	return nil
+}
+
+// errorRow returns a *sql.Row whose Scan fails with err.
+// database/sql doesn't allow building a Row, so it is obtained from a database whose
+// connections always fail with err.
+func errorRow(err error) *sql.Row {
+	errDB := sql.OpenDB(errConnector{err})
+	defer errDB.Close()
+	return errDB.QueryRow("")
+}
+
+// errConnector is a driver.Connector failing every connection attempt with err
+type errConnector struct {
+	err error
+}
+
+func (c errConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, c.err
+}
+
+func (c errConnector) Driver() driver.Driver {
+	return errDriver(c)
+}
+
+// errDriver is the driver.Driver of errConnector
+type errDriver struct {
+	err error
+}
+
+func (d errDriver) Open(string) (driver.Conn, error) {
+	return nil, d.err
+}
@@ -0,0 +1,197 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_RejectWritesOnRead(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithRejectWritesOnRead(true))
+	assert.Nil(t, err)
+
+	rows, err := db.Query("INSERT INTO t VALUES (1)")
+	assert.Nil(t, rows)
+	assert.Equal(t, err, ErrWriteOnReadPath)
+
+	var id int
+	err = db.QueryRow("DELETE FROM t RETURNING id").Scan(&id)
+	assert.Equal(t, err, ErrWriteOnReadPath)
+
+	row, err := db.QueryRowErr(context.Background(), "UPDATE t SET a = 1 RETURNING id")
+	assert.Equal(t, err, ErrWriteOnReadPath)
+	assert.Equal(t, row.Scan(&id), ErrWriteOnReadPath)
+
+	// a script is rejected as soon as one of its statements is a write
+	_, err = db.Query("SELECT id FROM t; DELETE FROM t")
+	assert.Equal(t, err, ErrWriteOnReadPath)
+
+	// reads are still served
+	mock1.ExpectQuery("SELECT id").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	assert.Nil(t, db.QueryRow("SELECT id FROM t").Scan(&id))
+	assert.Equal(t, id, 3)
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
+
+func TestDB_QueryRowErr(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1)
+	assert.Nil(t, err)
+
+	mock1.ExpectQuery("Query1").WillReturnError(errors.New("relation does not exist"))
+	row, err := db.QueryRowErr(context.Background(), "Query1")
+	assert.NotNil(t, row)
+	assert.Equal(t, err.Error(), "relation does not exist")
+
+	mock1.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	row, err = db.QueryRowErr(context.Background(), "Query2")
+	assert.Nil(t, err)
+	var id int
+	assert.Nil(t, row.Scan(&id))
+	assert.Equal(t, id, 1)
+}
+
+func TestIsReadQuery(t *testing.T) {
+	for query, read := range map[string]bool{
+		"SELECT 1":          true,
+		"  select * from t": true,
+		"WITH recent AS (SELECT * FROM t WHERE a = ')') SELECT * FROM recent":             true,
+		"with a as (select 1), b (x) as (select 2) select * from a, b":                    true,
+		"WITH gone AS (SELECT id FROM t) DELETE FROM u WHERE id IN (SELECT id FROM gone)": false,
+		"INSERT INTO t VALUES (1)":             false,
+		"without_table":                        false,
+		"-- hot path\n/* by id */ SELECT 1":    true,
+		"(SELECT 1) UNION (SELECT 2)":          true,
+		"EXPLAIN SELECT 1":                     true,
+		"EXPLAIN (ANALYZE, BUFFERS) SELECT 1":  true,
+		"explain format = json select 1":       true,
+		"EXPLAIN ANALYZE DELETE FROM t":        false,
+		"SHOW TABLES":                          true,
+		"TABLE t":                              true,
+		"UPDATE t SET a = 1":                   false,
+		"DELETE FROM t":                        false,
+		"CALL refresh()":                       false,
+		"/* unterminated":                      false,
+		"SELECT 1; SELECT 2":                   true,
+		"SELECT 1; -- done":                    true,
+		"SELECT 'a;b'; DELETE FROM t":          false,
+		"SELECT 1; /* ; */ UPDATE t SET a = 1": false,
+		"SELECT ';INSERT'":                     true,
+		"SELECT 1;; SHOW TABLES;":              true,
+		";":                                    false,
+	} {
+		assert.Equal(t, IsReadQuery(query), read, query)
+	}
+}
+
+func TestDB_MaxQueryLength(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithMaxQueryLength(16))
+	assert.Nil(t, err)
+
+	long := "SELECT * FROM t WHERE id IN (1, 2, 3)"
+	_, err = db.Query(long)
+	assert.Equal(t, err, ErrQueryTooLong)
+	assert.Equal(t, db.QueryRow(long).Scan(), ErrQueryTooLong)
+	_, err = db.Exec(long)
+	assert.Equal(t, err, ErrQueryTooLong)
+	_, err = db.Prepare(long)
+	assert.Equal(t, err, ErrQueryTooLong)
+	_, err = db.QueryOnReplica(context.Background(), 0, long)
+	assert.Equal(t, err, ErrQueryTooLong)
+
+	mock1.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("SELECT 1")
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
+
+func TestDB_QueryClassifier(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithRejectWritesOnRead(true),
+		WithQueryClassifier(func(query string) bool {
+			return IsReadQuery(query) || query == "CALL report()"
+		}))
+	assert.Nil(t, err)
+
+	mock1.ExpectPrepare("CALL report")
+	_, err = db.Prepare("CALL report()")
+	assert.Nil(t, err)
+	mock1.ExpectQuery("CALL report").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("CALL report()")
+	assert.Nil(t, err)
+
+	mock.ExpectPrepare("CALL refresh")
+	_, err = db.Prepare("CALL refresh()")
+	assert.Nil(t, err)
+	_, err = db.Query("CALL refresh()")
+	assert.Equal(t, err, ErrWriteOnReadPath)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
+
+func TestDB_Classify(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1},
+		WithQueryClassifier(func(query string) bool {
+			return IsReadQuery(query) || query == "CALL report()"
+		}))
+	assert.Nil(t, err)
+
+	target, isRead := db.Classify("SELECT 1")
+	assert.Equal(t, target, "replica")
+	assert.True(t, isRead)
+	target, isRead = db.Classify("CALL report()")
+	assert.Equal(t, target, "replica")
+	assert.True(t, isRead)
+	target, isRead = db.Classify("DELETE FROM users")
+	assert.Equal(t, target, "master")
+	assert.False(t, isRead)
+
+	db.readPreference = MasterOnly
+	target, isRead = db.Classify("SELECT 1")
+	assert.Equal(t, target, "master")
+	assert.True(t, isRead)
+}
@@ -0,0 +1,91 @@
+package mydb
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// StartHealthCheck pings every replica each interval and marks the failing ones down,
+// reads then skip them until a later ping succeeds, instead of discovering the outage
+// by failing over. When every replica is down, reads still try all of them.
+// The lag of the replicas is refreshed as well when a LagProvider is set, see RefreshLag.
+// Pings use ctx, the checker stops updating the replica states once ctx is done.
+//
+// Calling it again restarts the checker with the new settings.
+func (db *DB) StartHealthCheck(ctx context.Context, interval time.Duration) {
+	ctx = orBackground(ctx)
+	db.m.Lock()
+	defer db.m.Unlock()
+	db.healthCheck.Stop()
+	db.healthCheck = startLoop(db.clock, interval, func() {
+		db.checkHealth(ctx)
+	})
+}
+
+// StopHealthCheck stops the checker started by StartHealthCheck.
+// Replicas keep the state of the last check.
+func (db *DB) StopHealthCheck() {
+	db.m.Lock()
+	defer db.m.Unlock()
+	db.healthCheck.Stop()
+	db.healthCheck = nil
+}
+
+// checkHealth pings every replica and marks it up or down
+func (db *DB) checkHealth(ctx context.Context) {
+	replicas := db.replicas()
+	wentDown := false
+	down := 0
+	for i, r := range replicas {
+		err := r.db.PingContext(ctx)
+		if ctx.Err() != nil {
+			// the failure is ours, not the replica's
+			return
+		}
+		if err != nil && !r.isDown() {
+			// the statements prepared on the replica won't survive it going down
+			r.stmts.clear()
+			r.named.clear()
+			wentDown = true
+			db.logger.Warn("mydb: replica marked down", "replica", i, "err", err)
+		}
+		if err != nil {
+			down++
+		}
+		r.setDown(err != nil)
+	}
+	if wentDown && down == len(replicas) {
+		db.logger.Warn("mydb: every replica is down, reads still try them", "replicas", down)
+	}
+	// the replicas failing the measure keep their previous lag
+	_ = db.RefreshLag(ctx)
+}
+
+// setDown marks the replica down or up
+func (r *replica) setDown(down bool) {
+	var state int32
+	if down {
+		state = 1
+	}
+	atomic.StoreInt32(&r.down, state)
+}
+
+// isDown reports whether the last health check of the replica failed
+func (r *replica) isDown() bool {
+	return atomic.LoadInt32(&r.down) == 1
+}
+
+// upReplicas filters out the replicas marked down by the health check, unless all of them are
+func upReplicas(replicas []*replica, states []ReplicaState) []ReplicaState {
+	up := make([]ReplicaState, 0, len(states))
+	for _, state := range states {
+		if !replicas[state.Index].isDown() {
+			up = append(up, state)
+		}
+	}
+	if len(up) == 0 {
+		return states
+	}
+	return up
+}
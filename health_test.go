@@ -0,0 +1,54 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_HealthCheck(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk := newFakeClock()
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2}, withClock(clk))
+	assert.Nil(t, err)
+
+	replica2.Close()
+	db.StartHealthCheck(context.Background(), time.Minute)
+	clk.wait(1)
+	assert.False(t, db.readreplicas[1].isDown())
+	// the next tick is scheduled once the check is over
+	clk.advance(time.Minute)
+	clk.wait(1)
+	assert.True(t, db.readreplicas[1].isDown())
+	db.StopHealthCheck()
+	assert.False(t, db.readreplicas[0].isDown())
+
+	// replica2 is skipped without being tried
+	for i := 0; i < 2; i++ {
+		mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+		_, err = db.Query("Query1")
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, mock1.ExpectationsWereMet())
+
+	// every replica down, reads still try them
+	db.readreplicas[0].setDown(true)
+	order, err := db.readOrder()
+	assert.Nil(t, err)
+	assert.Len(t, order, 2)
+}
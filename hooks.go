@@ -0,0 +1,127 @@
+package mydb
+
+import (
+	"context"
+	"time"
+)
+
+// redactedArg replaces every query arg handed to hooks while arg redaction is enabled
+const redactedArg = "<redacted>"
+
+// FailoverEvent describes a read moving from a failed replica to the next one.
+type FailoverEvent struct {
+	// From is the index of the replica which failed
+	From int
+	// To is the index of the replica which is tried next
+	To int
+	// Err is the error returned by replica From
+	Err error
+	// Query is the query which triggered the failover
+	Query string
+	// Args are the query args, each of them replaced by "<redacted>"
+	// unless arg redaction is disabled with WithArgRedaction(false)
+	Args []interface{}
+}
+
+// WithOnFailover registers a hook invoked every time a read fails on a replica
+// and is retried on the next one.
+func WithOnFailover(fn func(FailoverEvent)) Option {
+	return func(db *DB) {
+		db.onFailover = fn
+	}
+}
+
+// WithBeforeQuery registers fn, invoked when a query, exec or prepare starts, before it is routed,
+// e.g. to tag it with the request id found in ctx. Queries include QueryRow and the like.
+func WithBeforeQuery(fn func(ctx context.Context, query string)) Option {
+	return func(db *DB) {
+		db.onBeforeQuery = fn
+	}
+}
+
+// WithAfterQuery registers fn, invoked once a query, exec or prepare returned, with its error
+// and how long it took, failovers and retries included, e.g. for an audit log.
+// The error of QueryRowContext is the one its Scan reports, see QueryRowErr.
+func WithAfterQuery(fn func(ctx context.Context, query string, err error, d time.Duration)) Option {
+	return func(db *DB) {
+		db.onAfterQuery = fn
+	}
+}
+
+// beforeQuery invokes the hook set with WithBeforeQuery and returns when the query started
+func (db *DB) beforeQuery(ctx context.Context, query string) time.Time {
+	if db.onBeforeQuery != nil && instrumented(ctx) {
+		db.onBeforeQuery(ctx, query)
+	}
+	return time.Now()
+}
+
+// afterQuery invokes the hook set with WithAfterQuery for the query started at start
+func (db *DB) afterQuery(ctx context.Context, query string, err error, start time.Time) {
+	if db.onAfterQuery != nil && instrumented(ctx) {
+		db.onAfterQuery(ctx, query, err, time.Since(start))
+	}
+}
+
+// WithArgRedaction enables or disables the redaction of query args handed to hooks.
+// Args are redacted by default, so sensitive values don't leak into logs.
+func WithArgRedaction(enabled bool) Option {
+	return func(db *DB) {
+		db.redactArgs = enabled
+	}
+}
+
+// hookArgs returns args as they must be exposed to hooks
+func (db *DB) hookArgs(args []interface{}) []interface{} {
+	if !db.redactArgs || len(args) == 0 {
+		return args
+	}
+	redacted := make([]interface{}, len(args))
+	for i := range redacted {
+		redacted[i] = redactedArg
+	}
+	return redacted
+}
+
+func (db *DB) failover(ctx context.Context, from, to int, err error, query string, args []interface{}) {
+	if !instrumented(ctx) {
+		return
+	}
+	db.logger.Warn("mydb: read failing over", "from", from, "to", to, "err", err)
+	if db.observer != nil {
+		db.observer.OnFailover(from, to)
+	}
+	if db.onFailover == nil {
+		return
+	}
+	db.onFailover(FailoverEvent{
+		From:  from,
+		To:    to,
+		Err:   err,
+		Query: query,
+		Args:  db.hookArgs(args),
+	})
+}
+
+// WithTightDeadlineWarning registers cb, invoked when a query, exec or prepare starts
+// with a context whose deadline is less than threshold away.
+// Such calls are likely to fail with a context error deep in the driver,
+// the warning points to the caller mismanaging its timeout budget.
+func WithTightDeadlineWarning(threshold time.Duration, cb func(ctx context.Context, remaining time.Duration)) Option {
+	return func(db *DB) {
+		db.deadlineThreshold = threshold
+		db.onTightDeadline = cb
+	}
+}
+
+// beforeCall is invoked at the start of every query, exec and prepare
+func (db *DB) beforeCall(ctx context.Context) {
+	if db.onTightDeadline == nil || !instrumented(ctx) {
+		return
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < db.deadlineThreshold {
+			db.onTightDeadline(ctx, remaining)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_OnFailover(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []FailoverEvent
+	onFailover := WithOnFailover(func(e FailoverEvent) {
+		events = append(events, e)
+	})
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2}, onFailover)
+	assert.Nil(t, err)
+
+	// replica2 is closed, first round robin pick is replica2
+	replica2.Close()
+	mock1.ExpectQuery("Query1").WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query1", 7)
+	assert.Nil(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, events[0].From, 1)
+	assert.Equal(t, events[0].To, 0)
+	assert.Equal(t, events[0].Query, "Query1")
+	assert.Equal(t, events[0].Args, []interface{}{redactedArg})
+	assert.Equal(t, events[0].Err.Error(), "sql: database is closed")
+
+	// args are exposed when redaction is disabled
+	events = nil
+	db, err = NewWithOptions(masterDB, []*sql.DB{replica1, replica2}, onFailover, WithArgRedaction(false))
+	assert.Nil(t, err)
+	mock1.ExpectQuery("Query2").WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query2", 7)
+	assert.Nil(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, events[0].Args, []interface{}{7})
+}
+
+func TestDB_TightDeadlineWarning(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warnings []time.Duration
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithTightDeadlineWarning(time.Second, func(ctx context.Context, remaining time.Duration) {
+		warnings = append(warnings, remaining)
+	}))
+	assert.Nil(t, err)
+
+	// plenty of time left
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	mock.ExpectExec("Query1").WillReturnResult(sqlmock.NewResult(1, 1))
+	_, err = db.ExecContext(ctx, "Query1")
+	assert.Nil(t, err)
+	assert.Len(t, warnings, 0)
+
+	// less than threshold left
+	ctx, cancel = context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	mock.ExpectExec("Query2").WillReturnResult(sqlmock.NewResult(1, 1))
+	_, err = db.ExecContext(ctx, "Query2")
+	assert.Nil(t, err)
+	assert.Len(t, warnings, 1)
+	assert.True(t, warnings[0] <= 500*time.Millisecond)
+
+	// no deadline at all
+	mock.ExpectExec("Query3").WillReturnResult(sqlmock.NewResult(1, 1))
+	_, err = db.Exec("Query3")
+	assert.Nil(t, err)
+	assert.Len(t, warnings, 1)
+}
+
+func TestDB_QueryHooks(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var before, after []string
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1},
+		WithBeforeQuery(func(ctx context.Context, query string) {
+			before = append(before, query)
+		}),
+		WithAfterQuery(func(ctx context.Context, query string, err error, d time.Duration) {
+			if err != nil {
+				query += ": " + err.Error()
+			}
+			after = append(after, query)
+		}),
+	)
+	assert.Nil(t, err)
+
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	mock.ExpectExec("Insert1").WillReturnError(errors.New("duplicate key"))
+	mock1.ExpectPrepare("Select1")
+	_, err = db.Query("Query1")
+	assert.Nil(t, err)
+	_, err = db.Exec("Insert1")
+	assert.NotNil(t, err)
+	_, err = db.Prepare("Select1")
+	assert.Nil(t, err)
+	// hooks are off without instrumentation
+	_, err = db.QueryContext(WithNoInstrumentation(context.Background()), "Query2")
+	assert.NotNil(t, err)
+
+	assert.Equal(t, before, []string{"Query1", "Insert1", "Select1"})
+	assert.Equal(t, after, []string{"Query1", "Insert1: duplicate key", "Select1"})
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
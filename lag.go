@@ -0,0 +1,130 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// unknownLag is the lag of a replica which was never measured
+const unknownLag = -1
+
+// LagProvider measures how far replica is lagging behind master, e.g. with
+// "SELECT now() - pg_last_xact_replay_timestamp()" on Postgres.
+type LagProvider func(ctx context.Context, replica *sql.DB) (time.Duration, error)
+
+// LagQuery returns a LagProvider running query on the replica, query must return
+// the lag in seconds, e.g. "SELECT EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())"
+// on Postgres. A NULL lag, e.g. of a replica which replayed nothing yet, is measured as 0.
+func LagQuery(query string) LagProvider {
+	return func(ctx context.Context, replica *sql.DB) (time.Duration, error) {
+		var seconds sql.NullFloat64
+		if err := replica.QueryRowContext(ctx, query).Scan(&seconds); err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds.Float64 * float64(time.Second)), nil
+	}
+}
+
+// WithLagProvider sets the provider used by RefreshLag to measure replication lag.
+func WithLagProvider(p LagProvider) Option {
+	return func(db *DB) {
+		db.lagProvider = p
+	}
+}
+
+// WithStaleReadThreshold makes DB report, through Observer.OnStaleRead, every read
+// served by a replica whose last measured lag is beyond soft.
+func WithStaleReadThreshold(soft time.Duration) Option {
+	return func(db *DB) {
+		db.staleReadThreshold = soft
+	}
+}
+
+// WithFreshRoundRobin restricts reads to the replicas whose last lag measured by RefreshLag
+// is within maxLag, the balancer then spreads reads among them. Replicas whose lag was never
+// measured are considered fresh.
+// When no replica is fresh enough, reads fail with ErrAllReplicasLagging, unless
+// fallbackToStale is set, in which case every replica is used, or the reads fall back
+// to master, see WithMasterReadFallback. The health checker refreshes the lag, see StartHealthCheck.
+func WithFreshRoundRobin(maxLag time.Duration, fallbackToStale bool) Option {
+	return func(db *DB) {
+		db.maxLag = maxLag
+		db.fallbackToStale = fallbackToStale
+	}
+}
+
+// freshReplicas filters out the replicas lagging more than the lag allowed by WithFreshRoundRobin
+func (db *DB) freshReplicas(states []ReplicaState) ([]ReplicaState, error) {
+	if db.maxLag <= 0 {
+		return states, nil
+	}
+	fresh := make([]ReplicaState, 0, len(states))
+	for _, state := range states {
+		if state.Lag <= db.maxLag {
+			fresh = append(fresh, state)
+		}
+	}
+	if len(fresh) > 0 {
+		return fresh, nil
+	}
+	if db.fallbackToStale {
+		return states, nil
+	}
+	return nil, ErrAllReplicasLagging
+}
+
+// RefreshLag measures the lag of every replica with the configured LagProvider
+// and remembers it for routing and metrics.
+// Replicas which can't be measured keep their previous lag, their errors are returned together.
+func (db *DB) RefreshLag(ctx context.Context) error {
+	ctx = orBackground(ctx)
+	if db.lagProvider == nil {
+		return nil
+	}
+	var errString []string
+	for i, r := range db.replicas() {
+		lag, err := db.lagProvider(ctx, r.db)
+		if err != nil {
+			errString = append(errString, fmt.Sprintf(replicaLagFailError, i+1, err.Error()))
+			continue
+		}
+		atomic.StoreInt64(&r.lag, int64(lag))
+		r.history.add(lag)
+	}
+	if len(errString) > 0 {
+		return errors.New(strings.Join(errString, "\n"))
+	}
+	return nil
+}
+
+// lastLag returns the last measured lag of the replica and whether it was ever measured
+func (r *replica) lastLag() (time.Duration, bool) {
+	lag := atomic.LoadInt64(&r.lag)
+	return time.Duration(lag), lag != unknownLag
+}
+
+// readServed is invoked once replica r served a read
+func (db *DB) readServed(ctx context.Context, r candidate) {
+	affinityOf(ctx).pin(r.index)
+	if db.observer == nil || !instrumented(ctx) {
+		return
+	}
+	db.observer.OnQueryRouted(r.index)
+	if lag, stale := db.staleLag(r.replica); stale {
+		db.observer.OnStaleRead(lag)
+	}
+}
+
+// staleLag returns the last lag of replica r and whether it is above the threshold set with WithStaleReadThreshold
+func (db *DB) staleLag(r *replica) (time.Duration, bool) {
+	if db.staleReadThreshold <= 0 {
+		return 0, false
+	}
+	lag, ok := r.lastLag()
+	return lag, ok && lag > db.staleReadThreshold
+}
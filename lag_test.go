@@ -0,0 +1,273 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// staleReads counts the stale reads reported to it
+type staleReads struct {
+	NopObserver
+	lags []time.Duration
+}
+
+func (o *staleReads) OnStaleRead(lag time.Duration) {
+	o.lags = append(o.lags, lag)
+}
+
+func TestDB_StaleRead(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lags := map[*sql.DB]time.Duration{replica1: time.Second, replica2: time.Minute}
+	observer := &staleReads{}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2},
+		WithLagProvider(func(ctx context.Context, replica *sql.DB) (time.Duration, error) {
+			return lags[replica], nil
+		}),
+		WithStaleReadThreshold(10*time.Second),
+		WithObserver(observer),
+	)
+	assert.Nil(t, err)
+
+	// lag is unknown till refreshed
+	mock2.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query1")
+	assert.Nil(t, err)
+	assert.Len(t, observer.lags, 0)
+
+	assert.Nil(t, db.RefreshLag(context.Background()))
+	mock1.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	mock2.ExpectQuery("Query3").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query2")
+	assert.Nil(t, err)
+	_, err = db.Query("Query3")
+	assert.Nil(t, err)
+	assert.Equal(t, observer.lags, []time.Duration{time.Minute})
+}
+
+func TestDB_RefreshLag(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2},
+		WithLagProvider(func(ctx context.Context, replica *sql.DB) (time.Duration, error) {
+			if replica == replica2 {
+				return 0, errors.New("permission denied")
+			}
+			return time.Second, nil
+		}),
+	)
+	assert.Nil(t, err)
+	err = db.RefreshLag(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, err.Error(), "replica db 2 lag measurement fail: permission denied")
+	lag, ok := db.readreplicas[0].lastLag()
+	assert.True(t, ok)
+	assert.Equal(t, lag, time.Second)
+	_, ok = db.readreplicas[1].lastLag()
+	assert.False(t, ok)
+}
+
+func TestDB_FreshRoundRobin(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica3, mock3, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lags := map[*sql.DB]time.Duration{replica1: time.Second, replica2: time.Minute, replica3: 2 * time.Second}
+	lagProvider := WithLagProvider(func(ctx context.Context, replica *sql.DB) (time.Duration, error) {
+		return lags[replica], nil
+	})
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2, replica3},
+		lagProvider, WithFreshRoundRobin(10*time.Second, false))
+	assert.Nil(t, err)
+	assert.Nil(t, db.RefreshLag(context.Background()))
+
+	// lagging replica2 is skipped, reads rotate between replica1 and replica3
+	mock3.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	mock1.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	mock3.ExpectQuery("Query3").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	for _, query := range []string{"Query1", "Query2", "Query3"} {
+		_, err = db.Query(query)
+		assert.Nil(t, err)
+	}
+	// failover does not reach the lagging replica either
+	mock1.ExpectQuery("Query4").WillReturnError(sql.ErrConnDone)
+	mock3.ExpectQuery("Query4").WillReturnError(sql.ErrConnDone)
+	_, err = db.Query("Query4")
+	assert.Equal(t, err.Error(), noReplicaAvailableError)
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+	assert.Nil(t, mock3.ExpectationsWereMet())
+
+	// every replica lagging
+	lags[replica1], lags[replica3] = time.Hour, time.Hour
+	assert.Nil(t, db.RefreshLag(context.Background()))
+	_, err = db.Query("Query5")
+	assert.True(t, errors.Is(err, ErrAllReplicasLagging))
+	_, err = db.QueryRowErr(context.Background(), "Query5")
+	assert.True(t, errors.Is(err, ErrAllReplicasLagging))
+
+	// unless stale replicas are allowed as a fallback
+	db, err = NewWithOptions(masterDB, []*sql.DB{replica1, replica2, replica3},
+		lagProvider, WithFreshRoundRobin(10*time.Second, true))
+	assert.Nil(t, err)
+	assert.Nil(t, db.RefreshLag(context.Background()))
+	mock2.ExpectQuery("Query6").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query6")
+	assert.Nil(t, err)
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
+func TestDB_LagHistory(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lag := time.Duration(0)
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1},
+		WithLagProvider(func(ctx context.Context, replica *sql.DB) (time.Duration, error) {
+			lag += time.Second
+			return lag, nil
+		}),
+		WithLagHistory(3),
+	)
+	assert.Nil(t, err)
+	assert.Len(t, db.LagHistory(0), 0)
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, db.RefreshLag(context.Background()))
+	}
+	assert.Equal(t, db.LagHistory(0), []time.Duration{time.Second, 2 * time.Second})
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, db.RefreshLag(context.Background()))
+	}
+	// oldest sample is overwritten
+	assert.Equal(t, db.LagHistory(0), []time.Duration{2 * time.Second, 3 * time.Second, 4 * time.Second})
+	assert.Nil(t, db.LagHistory(1))
+}
+
+func TestDB_LagSampler(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1},
+		WithLagProvider(func(ctx context.Context, replica *sql.DB) (time.Duration, error) {
+			return time.Second, nil
+		}),
+	)
+	assert.Nil(t, err)
+	db.StartLagSampler(time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return len(db.LagHistory(0)) >= 2
+	}, time.Second, time.Millisecond)
+	db.StopLagSampler()
+	samples := len(db.LagHistory(0))
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, len(db.LagHistory(0)), samples)
+}
+
+func TestDB_LagAwareRouting(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk := newFakeClock()
+	lagQuery := "SELECT EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())"
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2}, withClock(clk),
+		WithLagProvider(LagQuery(lagQuery)),
+		WithFreshRoundRobin(10*time.Second, false),
+		WithMasterReadFallback(true),
+	)
+	assert.Nil(t, err)
+	expectLag := func(m sqlmock.Sqlmock, seconds interface{}) {
+		m.ExpectQuery(regexp.QuoteMeta(lagQuery)).WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(seconds))
+	}
+
+	// the health checker measures replica2 lagging, it is skipped
+	expectLag(mock1, nil)
+	expectLag(mock2, 120.5)
+	db.StartHealthCheck(context.Background(), time.Minute)
+	clk.wait(1)
+	clk.advance(time.Minute)
+	clk.wait(1)
+	db.StopHealthCheck()
+	lag, ok := db.readreplicas[1].lastLag()
+	assert.True(t, ok)
+	assert.Equal(t, lag, 120500*time.Millisecond)
+	for i := 0; i < 2; i++ {
+		mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+		_, err = db.Query("Query1")
+		assert.Nil(t, err)
+	}
+
+	// every replica lagging, reads fall back to master
+	expectLag(mock1, 30)
+	expectLag(mock2, 120)
+	assert.Nil(t, db.RefreshLag(context.Background()))
+	mock.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, meta, err := db.QueryContextWithMeta(context.Background(), "Query2")
+	assert.Nil(t, err)
+	assert.Equal(t, meta.Node, masterNode)
+	// or fail without the fallback
+	db.readPreference = ReplicaOnly
+	_, err = db.Query("Query2")
+	assert.Equal(t, err, ErrAllReplicasLagging)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
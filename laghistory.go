@@ -0,0 +1,93 @@
+package mydb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultLagHistorySize is the number of lag samples kept per replica unless set with WithLagHistory
+const defaultLagHistorySize = 32
+
+// lagHistory is a ring buffer of the last lag samples of a replica
+type lagHistory struct {
+	m       sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+// newLagHistory returns a history keeping size samples, nil when size is not positive
+func newLagHistory(size int) *lagHistory {
+	if size <= 0 {
+		return nil
+	}
+	return &lagHistory{samples: make([]time.Duration, size)}
+}
+
+// add records a sample, overwriting the oldest one once the history is full. It is safe to call on a nil history.
+func (h *lagHistory) add(lag time.Duration) {
+	if h == nil {
+		return
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.samples[h.next] = lag
+	h.next = (h.next + 1) % len(h.samples)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// snapshot returns a copy of the samples, oldest first. It is safe to call on a nil history.
+func (h *lagHistory) snapshot() []time.Duration {
+	if h == nil {
+		return nil
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	if !h.full {
+		return append([]time.Duration(nil), h.samples[:h.next]...)
+	}
+	return append(append([]time.Duration(nil), h.samples[h.next:]...), h.samples[:h.next]...)
+}
+
+// WithLagHistory sets how many lag samples are kept per replica for LagHistory,
+// 32 by default. A size of 0 disables the history.
+func WithLagHistory(size int) Option {
+	return func(db *DB) {
+		db.lagHistorySize = size
+	}
+}
+
+// LagHistory returns the last lags measured on the replica at index, oldest first.
+// A steadily increasing history tells a replica falling behind from a momentary spike.
+// It returns nil when index is out of range or the history is disabled.
+func (db *DB) LagHistory(index int) []time.Duration {
+	r, err := db.replicaAt(index)
+	if err != nil {
+		return nil
+	}
+	return r.history.snapshot()
+}
+
+// StartLagSampler refreshes the lag of every replica each interval, see RefreshLag.
+// Measurement errors are dropped, failing replicas just miss a sample.
+//
+// Calling it again restarts the sampler with the new interval.
+func (db *DB) StartLagSampler(interval time.Duration) {
+	db.m.Lock()
+	defer db.m.Unlock()
+	db.lagSampler.Stop()
+	db.lagSampler = startLoop(db.clock, interval, func() {
+		db.RefreshLag(context.Background())
+	})
+}
+
+// StopLagSampler stops the sampler started by StartLagSampler.
+func (db *DB) StopLagSampler() {
+	db.m.Lock()
+	defer db.m.Unlock()
+	db.lagSampler.Stop()
+	db.lagSampler = nil
+}
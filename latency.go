@@ -0,0 +1,43 @@
+package mydb
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// latencyWeight is the weight of a new sample in the moving average of a replica latency
+const latencyWeight = 0.2
+
+// observeLatency adds the latency d of a read served by the replica to its moving average
+func (r *replica) observeLatency(d time.Duration) {
+	for {
+		old := atomic.LoadInt64(&r.latency)
+		avg := int64(d)
+		if old > 0 {
+			avg = old + int64(latencyWeight*float64(int64(d)-old))
+		}
+		if avg <= 0 {
+			// 0 means never measured
+			avg = 1
+		}
+		if atomic.CompareAndSwapInt64(&r.latency, old, avg) {
+			return
+		}
+	}
+}
+
+// lastLatency returns the moving average of the read latency of the replica, 0 till measured
+func (r *replica) lastLatency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&r.latency))
+}
+
+// ReplicaLatencies returns the moving average of the latency of the reads served by every replica,
+// in index order, 0 for the replicas which never served one. See the LowestLatency strategy.
+func (db *DB) ReplicaLatencies() []time.Duration {
+	replicas := db.replicas()
+	latencies := make([]time.Duration, len(replicas))
+	for i, r := range replicas {
+		latencies[i] = r.lastLatency()
+	}
+	return latencies
+}
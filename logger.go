@@ -0,0 +1,25 @@
+package mydb
+
+// Logger receives the operational warnings of mydb: a read failing over, a replica marked down
+// by the health check, every replica being down, a read no replica could serve, master failing to
+// close, and the nodes failing to close with CloseLogErrors.
+// kv are alternating keys and values, e.g. "from", 0, "to", 1, which adapts to most logging libraries.
+// Implementations must be safe for concurrent use by multiple goroutines.
+type Logger interface {
+	Warn(msg string, kv ...interface{})
+}
+
+// WithLogger sends the operational warnings of mydb to l, they are dropped by default.
+// A nil l keeps them dropped.
+func WithLogger(l Logger) Option {
+	return func(db *DB) {
+		if l != nil {
+			db.logger = l
+		}
+	}
+}
+
+// nopLogger is the default Logger, it drops every warning
+type nopLogger struct{}
+
+func (nopLogger) Warn(string, ...interface{}) {}
@@ -0,0 +1,88 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// warnings is a Logger recording the messages it receives
+type warnings struct {
+	msgs []string
+	kvs  [][]interface{}
+}
+
+func (w *warnings) Warn(msg string, kv ...interface{}) {
+	w.msgs = append(w.msgs, msg)
+	w.kvs = append(w.kvs, kv)
+}
+
+func TestDB_WithLogger(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := &warnings{}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2}, WithLogger(logger))
+	assert.Nil(t, err)
+
+	// a read failing over
+	replica1.Close()
+	replica2.Close()
+	_, err = db.Query("Query1")
+	assert.NotNil(t, err)
+	// then failing on every replica
+	assert.Equal(t, logger.msgs, []string{"mydb: read failing over", "mydb: no replica could serve the read"})
+	assert.Equal(t, logger.kvs[0][:4], []interface{}{"from", 1, "to", 0})
+	assert.Equal(t, logger.kvs[1][:4], []interface{}{"query", "Query1", "tried", 2})
+
+	// every replica going down
+	logger.msgs = nil
+	db.checkHealth(context.Background())
+	assert.Equal(t, logger.msgs, []string{
+		"mydb: replica marked down",
+		"mydb: replica marked down",
+		"mydb: every replica is down, reads still try them",
+	})
+	// replicas staying down are not reported again
+	logger.msgs = nil
+	db.checkHealth(context.Background())
+	assert.Nil(t, logger.msgs)
+
+	// master failing to close
+	errMaster := errors.New("master busy")
+	mock.ExpectClose().WillReturnError(errMaster)
+	assert.True(t, errors.Is(db.Close(), errMaster))
+	assert.Equal(t, logger.msgs, []string{"mydb: master failed to close"})
+	assert.Equal(t, logger.kvs[len(logger.kvs)-1], []interface{}{"err", errMaster})
+
+	// the errors logged by CloseLogErrors go to the Logger as well, once
+	masterDB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger = &warnings{}
+	db, err = NewWithOptions(masterDB, []*sql.DB{replica1}, WithLogger(logger), WithCloseErrorPolicy(CloseLogErrors))
+	assert.Nil(t, err)
+	mock.ExpectClose().WillReturnError(errMaster)
+	assert.Nil(t, db.Close())
+	assert.Equal(t, logger.msgs, []string{"mydb: close failed"})
+	assert.Equal(t, logger.kvs[0][1].(error).Error(), "master's db close fail: master busy")
+
+	// warnings are dropped by default
+	db, err = New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+	assert.Equal(t, db.logger, Logger(nopLogger{}))
+}
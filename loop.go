@@ -0,0 +1,40 @@
+package mydb
+
+import "time"
+
+// loop runs a function periodically in its own goroutine until stopped
+type loop struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startLoop calls fn every interval, as measured by c, until the returned loop is stopped
+func startLoop(c clock, interval time.Duration, fn func()) *loop {
+	l := &loop{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(l.done)
+		for {
+			tick, stop := c.After(interval)
+			select {
+			case <-l.stop:
+				stop()
+				return
+			case <-tick:
+				fn()
+			}
+		}
+	}()
+	return l
+}
+
+// Stop stops the loop and waits for a running call to return. It is safe to call on a nil loop.
+func (l *loop) Stop() {
+	if l == nil {
+		return
+	}
+	close(l.stop)
+	<-l.done
+}
@@ -0,0 +1,218 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnConverter converts a value scanned from a column into the Go value exposed by QueryMaps.
+// value is never nil.
+type ColumnConverter func(value interface{}) interface{}
+
+// timeLayouts are the layouts tried when a temporal column is returned as text
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+	"15:04:05",
+}
+
+// defaultColumnConverters maps database type names, as reported by
+// sql.ColumnType.DatabaseTypeName, to the conversion applied by QueryMaps
+var defaultColumnConverters = map[string]ColumnConverter{
+	"INT": toInt64, "INTEGER": toInt64, "SMALLINT": toInt64, "TINYINT": toInt64,
+	"MEDIUMINT": toInt64, "BIGINT": toInt64, "INT2": toInt64, "INT4": toInt64,
+	"INT8": toInt64, "SERIAL": toInt64, "BIGSERIAL": toInt64,
+	"UNSIGNED INT": toInt64, "UNSIGNED BIGINT": toInt64,
+
+	"FLOAT": toFloat64, "DOUBLE": toFloat64, "REAL": toFloat64, "DECIMAL": toFloat64,
+	"NUMERIC": toFloat64, "FLOAT4": toFloat64, "FLOAT8": toFloat64,
+
+	"BOOL": toBool, "BOOLEAN": toBool,
+
+	"DATE": toTime, "DATETIME": toTime, "TIMESTAMP": toTime, "TIMESTAMPTZ": toTime,
+
+	"CHAR": toString, "VARCHAR": toString, "NVARCHAR": toString, "TEXT": toString,
+	"BPCHAR": toString, "UUID": toString, "JSON": toString, "JSONB": toString,
+}
+
+// WithColumnConverters overrides the conversions applied by QueryMaps for the given
+// database type names, e.g. "NUMERIC". Names are matched case insensitively.
+// Types missing from both the defaults and converters are returned as scanned,
+// except []byte which becomes a string.
+func WithColumnConverters(converters map[string]ColumnConverter) Option {
+	return func(db *DB) {
+		merged := make(map[string]ColumnConverter, len(defaultColumnConverters)+len(converters))
+		for name, converter := range defaultColumnConverters {
+			merged[name] = converter
+		}
+		for name, converter := range converters {
+			merged[strings.ToUpper(name)] = converter
+		}
+		db.columnConverters = merged
+	}
+}
+
+// QueryMaps executes a query on read replicas and returns every row as a map
+// keyed by column name.
+// Values are converted to int64, float64, bool, time.Time or string according to
+// the declared column types, so the result marshals to JSON sensibly.
+func (db *DB) QueryMaps(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	converters := db.columnConverters
+	if converters == nil {
+		converters = defaultColumnConverters
+	}
+
+	var result []map[string]interface{}
+	values := make([]interface{}, len(columnTypes))
+	dest := make([]interface{}, len(columnTypes))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columnTypes))
+		for i, columnType := range columnTypes {
+			row[columnType.Name()] = convertColumn(converters, columnType.DatabaseTypeName(), values[i])
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+func convertColumn(converters map[string]ColumnConverter, typeName string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if converter, ok := converters[strings.ToUpper(typeName)]; ok {
+		return converter(value)
+	}
+	return toFallback(value)
+}
+
+// toFallback exposes raw bytes as text, other values are returned as scanned
+func toFallback(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return value
+}
+
+func toInt64(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case []byte:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i
+		}
+	case string:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+	}
+	return toFallback(value)
+}
+
+func toFloat64(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	case []byte:
+		if f, err := strconv.ParseFloat(string(v), 64); err == nil {
+			return f
+		}
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return toFallback(value)
+}
+
+func toBool(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case []byte:
+		if b, err := strconv.ParseBool(string(v)); err == nil {
+			return b
+		}
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return toFallback(value)
+}
+
+func toTime(value interface{}) interface{} {
+	var s string
+	switch v := value.(type) {
+	case time.Time:
+		return v
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return value
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return s
+}
+
+func toString(value interface{}) interface{} {
+	return toFallback(value)
+}
+
+// QueryStream executes a query on read replicas and calls fn for every row,
+// without materializing the result set. It stops at the first error returned by fn.
+//
+// The time until the first row is available is reported through Observer.OnFirstRow,
+// it tells how quickly the replica starts streaming independently from the throughput.
+func (db *DB) QueryStream(ctx context.Context, fn func(*sql.Rows) error, query string, args ...interface{}) error {
+	ctx = orBackground(ctx)
+	start := time.Now()
+	rows, meta, err := db.query(ctx, query, args)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	first := true
+	for rows.Next() {
+		if first {
+			first = false
+			if db.observer != nil && instrumented(ctx) {
+				db.observer.OnFirstRow(meta.Node, time.Since(start))
+			}
+		}
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,122 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_QueryMaps(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1)
+	assert.Nil(t, err)
+
+	rows := sqlmock.NewRows([]string{"id", "name", "deleted"}).
+		AddRow(int64(1), []byte("alice"), nil).
+		AddRow(int64(2), []byte("bob"), nil)
+	mock1.ExpectQuery("Query1").WillReturnRows(rows)
+	result, err := db.QueryMaps(context.Background(), "Query1")
+	assert.Nil(t, err)
+	assert.Equal(t, result, []map[string]interface{}{
+		{"id": int64(1), "name": "alice", "deleted": nil},
+		{"id": int64(2), "name": "bob", "deleted": nil},
+	})
+
+	// query error
+	replica1.Close()
+	result, err = db.QueryMaps(context.Background(), "Query2")
+	assert.Nil(t, result)
+	assert.Equal(t, err.Error(), "sql: database is closed")
+}
+
+func TestConvertColumn(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	converters := defaultColumnConverters
+	assert.Equal(t, convertColumn(converters, "bigint", []byte("42")), int64(42))
+	assert.Equal(t, convertColumn(converters, "NUMERIC", []byte("4.5")), 4.5)
+	assert.Equal(t, convertColumn(converters, "BOOL", []byte("true")), true)
+	assert.Equal(t, convertColumn(converters, "BOOLEAN", int64(0)), false)
+	assert.Equal(t, convertColumn(converters, "DATE", []byte("2019-10-01")), time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, convertColumn(converters, "VARCHAR", []byte("text")), "text")
+	assert.Equal(t, convertColumn(converters, "INT", []byte("not a number")), "not a number")
+	assert.Equal(t, convertColumn(converters, "GEOMETRY", []byte("point")), "point")
+	assert.Nil(t, convertColumn(converters, "INT", nil))
+
+	// user supplied converters override the defaults
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithColumnConverters(map[string]ColumnConverter{
+		"numeric": func(value interface{}) interface{} { return string(value.([]byte)) },
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, convertColumn(db.columnConverters, "NUMERIC", []byte("4.50")), "4.50")
+	assert.Equal(t, convertColumn(db.columnConverters, "INT", []byte("7")), int64(7))
+}
+
+// firstRows records the time to first row reported to it
+type firstRows struct {
+	NopObserver
+	nodes []string
+}
+
+func (o *firstRows) OnFirstRow(node string, d time.Duration) {
+	o.nodes = append(o.nodes, node)
+}
+
+func TestDB_QueryStream(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	observer := &firstRows{}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithObserver(observer))
+	assert.Nil(t, err)
+
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+	var ids []int
+	err = db.QueryStream(context.Background(), func(rows *sql.Rows) error {
+		var id int
+		err := rows.Scan(&id)
+		ids = append(ids, id)
+		return err
+	}, "Query1")
+	assert.Nil(t, err)
+	assert.Equal(t, ids, []int{1, 2, 3})
+	assert.Equal(t, observer.nodes, []string{"replica-0"})
+
+	// fn error stops the stream
+	mock1.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	calls := 0
+	err = db.QueryStream(context.Background(), func(rows *sql.Rows) error {
+		calls++
+		return errors.New("stop")
+	}, "Query2")
+	assert.Equal(t, err.Error(), "stop")
+	assert.Equal(t, calls, 1)
+
+	// empty result reports no first row
+	mock1.ExpectQuery("Query3").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	assert.Nil(t, db.QueryStream(context.Background(), func(rows *sql.Rows) error { return nil }, "Query3"))
+	assert.Len(t, observer.nodes, 2)
+}
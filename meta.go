@@ -0,0 +1,83 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Reasons of a degraded read, reported by QueryMeta.DegradationReason
+const (
+	// DegradedFailover is reported when the read failed on a replica and was served by another one
+	DegradedFailover = "failover"
+	// DegradedStale is reported when the read was served by a replica lagging more than
+	// the threshold set with WithStaleReadThreshold
+	DegradedStale = "stale replica"
+	// DegradedMasterFallback is reported when the read failed on every replica and was served by master,
+	// see WithMasterReadFallback
+	DegradedMasterFallback = "master fallback"
+)
+
+// QueryMeta describes how a read was served, see QueryContextWithMeta.
+type QueryMeta struct {
+	// Node is the node which served the read, "master" or "replica-<index>", empty when the read failed
+	Node string
+	// ReplicaIndex is the index of the replica which served the read, -1 when served by master or failed
+	ReplicaIndex int
+	// Failover is set when the read failed on a replica before being served
+	Failover bool
+	// Degraded is set when the read succeeded in a degraded way, the data may then be slightly stale
+	Degraded bool
+	// DegradationReason lists the reasons of the degradation, comma separated, e.g. "failover, stale replica"
+	DegradationReason string
+}
+
+// degrade marks the read degraded for reason
+func (m *QueryMeta) degrade(reason string) {
+	if m.Degraded {
+		m.DegradationReason += ", " + reason
+	} else {
+		m.DegradationReason = reason
+	}
+	m.Degraded = true
+}
+
+// servedBy returns the meta of a read issued to node, which failed when err is not nil
+func servedBy(node string, err error) QueryMeta {
+	if err != nil {
+		return unserved()
+	}
+	return QueryMeta{Node: node, ReplicaIndex: -1}
+}
+
+// unserved returns the meta of a read which failed
+func unserved() QueryMeta {
+	return QueryMeta{ReplicaIndex: -1}
+}
+
+// QueryContextWithMeta is QueryContext also describing how the read was served,
+// e.g. to flag the responses built from a degraded read.
+func (db *DB) QueryContextWithMeta(ctx context.Context, query string, args ...interface{}) (*sql.Rows, QueryMeta, error) {
+	ctx = orBackground(ctx)
+	return db.query(ctx, query, args)
+}
+
+// QueryContextWithStats is QueryContext also returning the statistics of the pool of the node
+// which served the read, taken right after it was served, e.g. to shed load client side when
+// InUse gets close to MaxOpenConnections. The statistics are zero when the read failed.
+func (db *DB) QueryContextWithStats(ctx context.Context, query string, args ...interface{}) (*sql.Rows, sql.DBStats, error) {
+	ctx = orBackground(ctx)
+	rows, _, served, err := db.queryServed(ctx, query, args)
+	if err != nil {
+		return nil, sql.DBStats{}, err
+	}
+	// the handle of the node is the one which served the read, even when the replica set changed meanwhile
+	return rows, served.Stats(), nil
+}
+
+// servedNode returns node, the node a read was issued to, or nil when the read failed with err
+func servedNode(node *sql.DB, err error) *sql.DB {
+	if err != nil {
+		return nil
+	}
+	return node
+}
@@ -0,0 +1,147 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_QueryContextWithMeta(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2},
+		WithLagProvider(func(ctx context.Context, replica *sql.DB) (time.Duration, error) {
+			if replica == replica1 {
+				return time.Minute, nil
+			}
+			return 0, nil
+		}),
+		WithStaleReadThreshold(time.Second),
+		WithMasterReadFallback(true),
+	)
+	assert.Nil(t, err)
+	assert.Nil(t, db.RefreshLag(context.Background()))
+	ctx := context.Background()
+
+	mock2.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, meta, err := db.QueryContextWithMeta(ctx, "Query1")
+	assert.Nil(t, err)
+	assert.Equal(t, meta, QueryMeta{Node: "replica-1", ReplicaIndex: 1})
+
+	mock1.ExpectQuery("Query2").WillReturnError(errors.New("down"))
+	mock2.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, meta, err = db.QueryContextWithMeta(ctx, "Query2")
+	assert.Nil(t, err)
+	assert.Equal(t, meta, QueryMeta{Node: "replica-1", ReplicaIndex: 1, Failover: true, Degraded: true, DegradationReason: DegradedFailover})
+
+	mock2.ExpectQuery("Query3").WillReturnError(errors.New("down"))
+	mock1.ExpectQuery("Query3").WillReturnError(errors.New("unreachable"))
+	mock.ExpectQuery("Query3").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, meta, err = db.QueryContextWithMeta(ctx, "Query3")
+	assert.Nil(t, err)
+	assert.Equal(t, meta, QueryMeta{Node: masterNode, ReplicaIndex: -1, Failover: true, Degraded: true, DegradationReason: DegradedMasterFallback})
+
+	mock1.ExpectQuery("Query4").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, meta, err = db.QueryContextWithMeta(ctx, "Query4")
+	assert.Nil(t, err)
+	assert.Equal(t, meta, QueryMeta{Node: "replica-0", Degraded: true, DegradationReason: DegradedStale})
+
+	_, meta, err = db.QueryContextWithMeta(WithMaster(ctx), "Query5")
+	assert.NotNil(t, err)
+	assert.Equal(t, meta, QueryMeta{ReplicaIndex: -1})
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
+func TestQueryMeta_Degrade(t *testing.T) {
+	var meta QueryMeta
+	meta.degrade(DegradedFailover)
+	meta.degrade(DegradedStale)
+	assert.Equal(t, meta, QueryMeta{Degraded: true, DegradationReason: "failover, stale replica"})
+}
+
+func TestDB_QueryContextWithStats(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+	replica2.SetMaxOpenConns(5)
+
+	// the connection of the rows is in use
+	mock2.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}).AddRow(1))
+	rows, stats, err := db.QueryContextWithStats(context.Background(), "Query1")
+	assert.Nil(t, err)
+	assert.Equal(t, stats.InUse, 1)
+	assert.Equal(t, stats.MaxOpenConnections, 5)
+	rows.Close()
+
+	mock1.ExpectQuery("Query2").WillReturnError(errors.New("down"))
+	mock2.ExpectQuery("Query2").WillReturnError(errors.New("down"))
+	_, stats, err = db.QueryContextWithStats(context.Background(), "Query2")
+	assert.NotNil(t, err)
+	assert.Equal(t, stats, sql.DBStats{})
+
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
+func TestDB_QueryContextWithStatsReplicaRemoved(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica3, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// replica1 is removed once the read is served, replica3 then takes index 1
+	db, err := New(masterDB, replica1, replica2, replica3)
+	assert.Nil(t, err)
+	WithAfterQuery(func(context.Context, string, error, time.Duration) {
+		assert.Nil(t, db.RemoveReplica(replica1))
+	})(db)
+	replica2.SetMaxOpenConns(5)
+	replica3.SetMaxOpenConns(7)
+
+	mock2.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}).AddRow(1))
+	rows, stats, err := db.QueryContextWithStats(context.Background(), "Query1")
+	assert.Nil(t, err)
+	assert.Equal(t, stats.MaxOpenConnections, 5)
+	rows.Close()
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
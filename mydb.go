@@ -5,34 +5,52 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"strings"
+	"math/rand"
 	"sync"
 	"time"
 )
 
-// IFace represents the mydb capabilities-
-// It is also used to generate mock test present in mock package
-// User of this library also take the advantage of mock
-type IFace interface {
+// Reader represents the read capabilities of mydb, which are served by read replicas.
+type Reader interface {
+	Prepare(query string) (*sql.Stmt, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+
+	QueryRow(query string, args ...interface{}) *sql.Row
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Writer represents the write capabilities of mydb, which are served by master db.
+type Writer interface {
 	Begin() (*sql.Tx, error)
 	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 
-	Close() error
-
 	Exec(query string, args ...interface{}) (sql.Result, error)
 	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
 
+// Pinger represents the health check capabilities of mydb.
+type Pinger interface {
 	Ping() error
 	PingContext(ctx context.Context) error
+}
 
-	Prepare(query string) (*sql.Stmt, error)
-	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
-
-	Query(query string, args ...interface{}) (*sql.Rows, error)
-	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+// Closer represents the close capability of mydb.
+type Closer interface {
+	Close() error
+}
 
-	QueryRow(query string, args ...interface{}) *sql.Row
-	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+// IFace represents the mydb capabilities-
+// It is also used to generate mock test present in mock package
+// User of this library also take the advantage of mock.
+// Depend on Reader, Writer, Pinger or Closer when only a part of it is needed.
+type IFace interface {
+	Reader
+	Writer
+	Pinger
+	Closer
 
 	SetConnMaxLifetime(d time.Duration)
 	SetMaxIdleConns(n int)
@@ -43,80 +61,276 @@ type IFace interface {
 // mydb package perform read operation on replica set and other operation on master.
 type DB struct {
 	IFace
-	count        int
 	master       *sql.DB
-	readreplicas []*sql.DB
+	readreplicas []*replica
 	m            sync.Mutex
+	balancer     Balancer
+
+	// replicasMu guards readreplicas, which is replaced rather than modified: once the
+	// constructor returned, readreplicas is only read through replicas, which hands out
+	// a snapshot the routing keeps using whatever AddReplica and RemoveReplica do meanwhile
+	replicasMu sync.RWMutex
+	// lastReplicaID is the id of the last replica created, accessed atomically
+	lastReplicaID uint64
+
+	// masterWriteProbe is run by NewWithOptions to verify master accepts writes
+	masterWriteProbe func(*sql.DB) error
+	// replicaReadOnlyProbe is run on every replica by VerifyReadOnly to verify it is read-only
+	replicaReadOnlyProbe string
+
+	// onFailover is invoked every time a read moves from a failed replica to the next one
+	onFailover func(FailoverEvent)
+	// logger receives the operational warnings, see WithLogger
+	logger Logger
+	// redactArgs hides query args from every hook, it is enabled by default
+	redactArgs bool
+
+	// onTightDeadline is invoked when a call starts with less than deadlineThreshold left
+	onTightDeadline   func(ctx context.Context, remaining time.Duration)
+	deadlineThreshold time.Duration
+
+	// observer receives metric events, nil when not registered
+	observer Observer
+
+	// poolMonitor samples the pools for saturation, guarded by m
+	poolMonitor *loop
+	// lagSampler refreshes the replication lag periodically, guarded by m
+	lagSampler *loop
+	// healthCheck pings the replicas periodically, guarded by m
+	healthCheck    *loop
+	lagHistorySize int
+
+	// lagProvider measures the replication lag of replicas
+	lagProvider        LagProvider
+	staleReadThreshold time.Duration
+	// maxLag excludes from reads the replicas lagging more, unless all of them are and fallbackToStale is set
+	maxLag          time.Duration
+	fallbackToStale bool
+	// readPreference is where the reads are served, PreferReplica retries on master
+	// the reads which failed on every replica
+	readPreference   ReadPreference
+	onMasterFallback func(ctx context.Context, query string, err error)
+	// onBeforeQuery and onAfterQuery wrap every query, exec and prepare
+	onBeforeQuery func(ctx context.Context, query string)
+	onAfterQuery  func(ctx context.Context, query string, err error, d time.Duration)
+	// acquisitionTiming times connection acquisition apart from execution
+	acquisitionTiming bool
+	onPoolWait        func(ctx context.Context, node string, wait time.Duration)
+	poolWaitThreshold time.Duration
+	// masterMaxIdle is the max idle connections set on master, accessed atomically
+	masterMaxIdle int64
+	// closeErrorPolicy tells Close how to handle the nodes failing to close
+	closeErrorPolicy CloseErrorPolicy
+	// retryPolicy retries the calls failed with a transient error
+	retryPolicy RetryPolicy
+	// recorder captures the issued queries, see WithQueryRecorder
+	recorder *queryRecorder
+
+	// errorContext prefixes the errors of master with the failed operation
+	errorContext bool
+
+	// readsThroughTx makes reads use the transaction carried by their context
+	readsThroughTx bool
+
+	// rejectWritesOnRead makes the read path refuse statements which are not reads
+	rejectWritesOnRead bool
+	// maxQueryLength is the length above which queries are refused, 0 means unlimited
+	maxQueryLength int
+	// breakerFailures and breakerCooldown configure the replica circuit breakers, see WithCircuitBreaker
+	breakerFailures int
+	breakerCooldown time.Duration
+	// retryBudget caps the retries and failovers, nil when unlimited
+	retryBudget *retryBudget
+	// isRead classifies queries, nil for IsReadQuery, see WithQueryClassifier
+	isRead func(query string) bool
+	// defaultTimeout bounds the calls made without a context, see WithDefaultTimeout
+	defaultTimeout time.Duration
+	// shardMasters are the masters added by WithShardMasters, master being shard 0
+	shardMasters []*sql.DB
+	// slowQueryThreshold and onSlowQuery configure the slow query log, see WithSlowQueryLog
+	slowQueryThreshold time.Duration
+	onSlowQuery        func(SlowQuery)
+	// tokenProvider and tokenWait configure QueryAfter, see WithTokenProvider
+	tokenProvider TokenProvider
+	tokenWait     time.Duration
+
+	// columnConverters overrides the type conversions of QueryMaps
+	columnConverters map[string]ColumnConverter
+
+	// stmtCacheSize is the default size of the per node statement caches, 0 disables caching
+	stmtCacheSize int
+	masterStmts   *stmtCache
+	// cachedStmts prepares the statements returned by PrepareContext through the statement caches,
+	// nil when caching is disabled
+	cachedStmts *sql.DB
+
+	// prepareAffinity remembers the replicas which recently prepared a query, nil when disabled
+	prepareAffinity *prepareAffinity
+
+	// onStmtClose is invoked when a Stmt returned by PrepareStmt is closed
+	onStmtClose func(node string, lived time.Duration)
+
+	// rnd is the source of randomness of every stochastic feature, guarded by rndMu
+	rnd   *rand.Rand
+	rndMu sync.Mutex
+
+	// registered are the queries registered by name, see Register, guarded by registeredMu
+	registered   map[string]string
+	registeredMu sync.RWMutex
+	// masterNamed are the registered statements prepared on master
+	masterNamed *stmtCache
+
+	// clock is the source of time of the health checker, the background loops and the retry backoff
+	clock clock
 }
 
 // New returns a new instance of library handle i.e. DB
-// at least one read replica instance is expected
+// at least one read replica instance is expected, master and the read replicas must not be nil
 func New(master *sql.DB, readreplicas ...*sql.DB) (*DB, error) {
-	if len(readreplicas) == 0 {
-		return nil, errors.New(noReadReplicaError)
+	return NewWithOptions(master, readreplicas)
+}
+
+// NewWithOptions returns a new instance of library handle i.e. DB
+// configured with the given options.
+// at least one read replica instance is expected
+func NewWithOptions(master *sql.DB, readreplicas []*sql.DB, opts ...Option) (*DB, error) {
+	configs := make([]ReplicaConfig, len(readreplicas))
+	for i := range readreplicas {
+		configs[i] = ReplicaConfig{DB: readreplicas[i]}
 	}
-	return &DB{
-		master:       master,
-		m:            sync.Mutex{},
-		readreplicas: readreplicas,
-	}, nil
+	return NewWithReplicas(master, configs, opts...)
 }
 
-func (db *DB) readReplicaNumberRoundRobin() int {
-	db.m.Lock()
-	defer db.m.Unlock()
-	db.count++
-	return db.count % len(db.readreplicas)
+// NewWithReplicas returns a new instance of library handle i.e. DB
+// using per replica configuration.
+// at least one read replica instance is expected
+func NewWithReplicas(master *sql.DB, readreplicas []ReplicaConfig, opts ...Option) (*DB, error) {
+	if master == nil {
+		return nil, ErrNilMaster
+	}
+	if len(readreplicas) == 0 {
+		return nil, ErrNoReadReplica
+	}
+	for i := range readreplicas {
+		if readreplicas[i].DB == nil {
+			return nil, fmt.Errorf(nilReplicaAtError, i+1, ErrNilReplica)
+		}
+	}
+	db := &DB{
+		master:         master,
+		m:              sync.Mutex{},
+		balancer:       &roundRobin{},
+		clock:          realClock{},
+		logger:         nopLogger{},
+		rnd:            rand.New(rand.NewSource(time.Now().UnixNano())),
+		redactArgs:     true,
+		lagHistorySize: defaultLagHistorySize,
+		masterMaxIdle:  defaultMaxIdleConns,
+	}
+	for _, opt := range opts {
+		opt(db)
+	}
+	for i, m := range db.shardMasters {
+		if m == nil {
+			return nil, fmt.Errorf(nilShardMasterError, i+1, ErrNilMaster)
+		}
+	}
+	db.seedRoundRobin(len(readreplicas))
+	db.masterStmts = newStmtCache(db.stmtCacheSize)
+	db.masterNamed = newNamedStmts()
+	if db.stmtCacheSize > 0 {
+		db.cachedStmts = sql.OpenDB(stdlibConnector{db: db, cached: true})
+	}
+	db.readreplicas = make([]*replica, len(readreplicas))
+	for i := range readreplicas {
+		db.readreplicas[i] = db.newReplica(readreplicas[i])
+	}
+	if db.masterWriteProbe != nil {
+		if err := db.VerifyMasterWritable(context.Background(), db.masterWriteProbe); err != nil {
+			return nil, err
+		}
+	}
+	if db.replicaReadOnlyProbe != "" {
+		if err := db.VerifyReadOnly(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
 }
 
 // pingChanResponse is a response handler for ping channel
 type pingChanResponse struct {
-	err error
+	index int
+	err   error
 }
 
 // Ping verifies a connection to the database is still alive,
 // establishing a connection if necessary.
 func (db *DB) Ping() error {
-	return db.PingContext(context.Background())
+	ctx, cancel := db.defaultContext()
+	defer cancel()
+	return db.PingContext(ctx)
 }
 
-func (db *DB) ping(ctx context.Context, i int, pingChan chan pingChanResponse) {
+func (db *DB) ping(ctx context.Context, i int, r *replica, pingChan chan pingChanResponse) {
 	var e error
-	if err := db.readreplicas[i].PingContext(ctx); err != nil {
-		e = fmt.Errorf(replicaPingFailError, i+1, err.Error())
+	if err := r.db.PingContext(ctx); err != nil {
+		e = &ReplicaPingError{Index: i, Err: err}
 	}
-	pingChan <- pingChanResponse{e}
+	pingChan <- pingChanResponse{i, e}
 }
 
 // PingContext verifies a connection to the database is still alive,
 // establishing a connection if necessary.
+// The errors of every node, master, the shard masters and the replicas, are joined,
+// the error of a replica is a *ReplicaPingError.
 func (db *DB) PingContext(ctx context.Context) error {
-	var errString []string
+	ctx = orBackground(ctx)
+	var errs []error
+	if err := db.PingMaster(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	for i, m := range db.shardMasters {
+		if err := m.PingContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf(shardMasterPingFailError, i+1, err))
+		}
+	}
+	for _, err := range db.PingReplicas(ctx) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PingMaster verifies a connection to master is still alive, independently of the replicas.
+func (db *DB) PingMaster(ctx context.Context) error {
+	ctx = orBackground(ctx)
 	if err := db.master.PingContext(ctx); err != nil {
-		e := fmt.Errorf(masterPingFailError, err.Error())
-		errString = append(errString, e.Error())
+		return fmt.Errorf(masterPingFailError, err)
 	}
+	return nil
+}
 
+// PingReplicas pings every replica concurrently, independently of master.
+// It returns one error per replica in index order, nil when the replica is alive,
+// the error of a replica is a *ReplicaPingError.
+func (db *DB) PingReplicas(ctx context.Context) []error {
+	ctx = orBackground(ctx)
 	// pingChan is used to listen the ping response from concurrent ping request for replicas
-	pingChan := make(chan pingChanResponse, len(db.readreplicas))
+	replicas := db.replicas()
+	pingChan := make(chan pingChanResponse, len(replicas))
 	defer close(pingChan)
-	for i := range db.readreplicas {
-		go db.ping(ctx, i, pingChan)
+	for i, r := range replicas {
+		go db.ping(ctx, i, r, pingChan)
 	}
 
-	for i := 0; i < len(db.readreplicas); i++ {
-		chanResp, ok := <-pingChan
-		if !ok {
-			return errors.New(pingChannelCloseError)
-		}
-		if chanResp.err != nil {
-			errString = append(errString, chanResp.err.Error())
-		}
-	}
-	if len(errString) > 0 {
-		return errors.New(strings.Join(errString, "\n"))
+	errs := make([]error, len(replicas))
+	for range replicas {
+		chanResp := <-pingChan
+		errs[chanResp.index] = chanResp.err
 	}
-	return nil
+	return errs
 }
 
 // Query executes a query that returns rows, typically a SELECT.
@@ -124,7 +338,12 @@ func (db *DB) PingContext(ctx context.Context) error {
 //
 // This operation is performed on read replicas only
 func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	return db.QueryContext(context.Background(), query, args...)
+	ctx, cancel := db.rowsContext()
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		cancel()
+	}
+	return rows, err
 }
 
 // QueryContext executes a query that returns rows, typically a SELECT.
@@ -132,24 +351,95 @@ func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
 //
 // This operation is performed on read replicas only.
 func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	replicaIndex := db.readReplicaNumberRoundRobin()
-	rows, err := db.readreplicas[replicaIndex].QueryContext(ctx, query, args...)
-	if err == nil {
-		return rows, err
+	ctx = orBackground(ctx)
+	rows, _, err := db.query(ctx, query, args)
+	return rows, err
+}
+
+// query executes the query on read replicas and also describes how it was served
+func (db *DB) query(ctx context.Context, query string, args []interface{}) (*sql.Rows, QueryMeta, error) {
+	rows, meta, _, err := db.queryServed(ctx, query, args)
+	return rows, meta, err
+}
+
+// queryServed is query also returning the node which served the read, nil when the read failed
+func (db *DB) queryServed(ctx context.Context, query string, args []interface{}) (*sql.Rows, QueryMeta, *sql.DB, error) {
+	start := db.beforeQuery(ctx, query)
+	rows, meta, served, err := db.routeQuery(ctx, query, args)
+	db.afterQuery(ctx, query, err, start)
+	return rows, meta, served, err
+}
+
+// routeQuery routes the query to the node serving it, see queryServed
+func (db *DB) routeQuery(ctx context.Context, query string, args []interface{}) (*sql.Rows, QueryMeta, *sql.DB, error) {
+	db.beforeCall(ctx)
+	if err := db.checkLength(query); err != nil {
+		return nil, unserved(), nil, err
+	}
+	start := time.Now()
+	if db.readsOnMaster(ctx) {
+		rows, err := db.master.QueryContext(ctx, query, args...)
+		db.record(ctx, start, masterNode, query, args, err)
+		return rows, servedBy(masterNode, err), servedNode(db.master, err), err
+	}
+	if err := db.checkReadPath(query); err != nil {
+		return nil, unserved(), nil, err
+	}
+	if tx := db.activeTx(ctx); tx != nil {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != sql.ErrTxDone {
+			db.record(ctx, start, masterNode, query, args, err)
+			return rows, servedBy(masterNode, err), servedNode(db.master, err), err
+		}
+	}
+	order, err := db.readOrderFor(ctx)
+	if err != nil && !db.lagFallback(err) {
+		db.record(ctx, start, "", query, args, err)
+		return nil, unserved(), nil, err
 	}
 	// if selected replica is down or not alive for read request, Algorithm will select next available replica
 	// for reading data in below lines
 	// If all replicas are closed or not alive then error is return  "noReplicaAvailableError"
-	for i := replicaIndex + 1; ; i++ {
-		newIndex := i % len(db.readreplicas)
-		if newIndex == replicaIndex {
-			return nil, errors.New(noReplicaAvailableError)
+	var rows *sql.Rows
+	res := db.tryReplicas(ctx, order, err, replicaRead{
+		query: query,
+		args:  args,
+		attempt: func(r candidate) error {
+			attempt := time.Now()
+			var err error
+			rows, err = db.queryOn(ctx, replicaNode(r.index), r.db, query, args)
+			if err == nil {
+				r.observeLatency(time.Since(attempt))
+			}
+			return err
+		},
+		fallback: true,
+	})
+	if res.err == nil {
+		r := res.served
+		db.record(ctx, start, replicaNode(r.index), query, args, nil)
+		meta := QueryMeta{Node: replicaNode(r.index), ReplicaIndex: r.index}
+		if res.failedOver {
+			meta.Failover = true
+			meta.degrade(DegradedFailover)
+		}
+		if _, stale := db.staleLag(r.replica); stale {
+			meta.degrade(DegradedStale)
 		}
-		rows, err := db.readreplicas[newIndex].QueryContext(ctx, query, args...)
+		return rows, meta, r.db, nil
+	}
+	if res.fallback {
+		rows, err := db.master.QueryContext(ctx, query, args...)
+		db.record(ctx, start, masterNode, query, args, err)
+		meta := servedBy(masterNode, err)
 		if err == nil {
-			return rows, err
+			meta.Failover = true
+			meta.degrade(DegradedMasterFallback)
 		}
+		return rows, meta, servedNode(db.master, err), err
 	}
+	db.record(ctx, start, "", query, args, res.err)
+	return nil, unserved(), nil, res.err
 }
 
 // QueryRow executes a query that is expected to return at most one row.
@@ -161,7 +451,12 @@ func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{
 //
 // QueryRow perform the query on replicas.
 func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
-	return db.QueryRowContext(context.Background(), query, args...)
+	ctx, cancel := db.rowsContext()
+	row := db.QueryRowContext(ctx, query, args...)
+	if row.Err() != nil {
+		cancel()
+	}
+	return row
 }
 
 // QueryRowContext executes a query that is expected to return at most one row.
@@ -171,9 +466,89 @@ func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
 // Otherwise, the *Row's Scan scans the first selected row and discards
 // the rest.
 //
-// QueryRowContext perform the query on replicas.
+// QueryRowContext perform the query on replicas. When the replica is unavailable, e.g. its
+// connections are broken or it is closed, the query fails over to the next replica like
+// QueryContext does. The error of a query failing on an available replica is not failed over,
+// it is deferred to Scan like database/sql does, unless ctx selects QueryRowFailover with WithQueryRowStrategy.
 func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
-	return db.readreplicas[db.readReplicaNumberRoundRobin()].QueryRowContext(ctx, query, args...)
+	row, _ := db.QueryRowErr(ctx, query, args...)
+	return row
+}
+
+// QueryRowErr is like QueryRowContext, but also returns eagerly the error which
+// QueryRowContext defers until Row's Scan method is called.
+// The returned *sql.Row is never nil, its Scan reports the same error.
+// The errors met reading the row, e.g. sql.ErrNoRows, are still reported by Scan only.
+//
+// Replicas are failed over like QueryRowContext does.
+func (db *DB) QueryRowErr(ctx context.Context, query string, args ...interface{}) (*sql.Row, error) {
+	ctx = orBackground(ctx)
+	start := db.beforeQuery(ctx, query)
+	row, err := db.queryRow(ctx, query, args)
+	db.afterQuery(ctx, query, err, start)
+	return row, err
+}
+
+// queryRow executes a query expected to return at most one row, see QueryRowErr
+func (db *DB) queryRow(ctx context.Context, query string, args []interface{}) (*sql.Row, error) {
+	db.beforeCall(ctx)
+	if err := db.checkLength(query); err != nil {
+		return errorRow(err), err
+	}
+	start := time.Now()
+	if db.readsOnMaster(ctx) {
+		row := db.master.QueryRowContext(ctx, query, args...)
+		db.record(ctx, start, masterNode, query, args, row.Err())
+		return row, row.Err()
+	}
+	if err := db.checkReadPath(query); err != nil {
+		return errorRow(err), err
+	}
+	if tx := db.activeTx(ctx); tx != nil {
+		row := tx.QueryRowContext(ctx, query, args...)
+		if err := row.Err(); err != sql.ErrTxDone {
+			db.record(ctx, start, masterNode, query, args, err)
+			return row, err
+		}
+	}
+	order, err := db.readOrderFor(ctx)
+	if err != nil && !db.lagFallback(err) {
+		db.record(ctx, start, "", query, args, err)
+		return errorRow(err), err
+	}
+	failover := queryRowStrategy(ctx) == QueryRowFailover
+	var row *sql.Row
+	res := db.tryReplicas(ctx, order, err, replicaRead{
+		query: query,
+		args:  args,
+		attempt: func(r candidate) error {
+			row = r.db.QueryRowContext(ctx, query, args...)
+			return row.Err()
+		},
+		final: func(err error) bool {
+			// the replica is up, the error is the one of the query
+			return !failover && !connectionFailure(err)
+		},
+		fallback: true,
+	})
+	// the read is recorded once, on the node which answered it last
+	switch {
+	case res.err == nil:
+		db.record(ctx, start, replicaNode(res.served.index), query, args, nil)
+		return row, nil
+	case res.fallback:
+		row = db.master.QueryRowContext(ctx, query, args...)
+		db.record(ctx, start, masterNode, query, args, row.Err())
+		return row, row.Err()
+	case res.node != "":
+		db.record(ctx, start, res.node, query, args, res.err)
+		return row, res.err
+	}
+	db.record(ctx, start, "", query, args, res.err)
+	if row != nil && res.err == row.Err() {
+		return row, res.err
+	}
+	return errorRow(res.err), res.err
 }
 
 // Begin starts a transaction on master db
@@ -181,22 +556,22 @@ func (db *DB) Begin() (*sql.Tx, error) {
 	return db.BeginTx(context.Background(), nil)
 }
 
-// BeginTx starts a transaction on master db.
+// BeginTx starts a transaction on master db, or on a read replica, with failover,
+// when opts.ReadOnly is set. A context returned by WithMaster beats opts.ReadOnly:
+// the read-only transactions begun with it run on master, e.g. to see the latest writes,
+// as do all of them with the MasterOnly read preference. When the replicas can't be reached,
+// errors.Is matches the error with ErrNoReplicaAvailable.
 //
 // The provided TxOptions is optional and may be nil if defaults should be used.
 // If a non-default isolation level is used that the driver doesn't support,
 // an error will be returned.
 func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
-	return db.master.BeginTx(ctx, opts)
-}
-
-// Close returns the connection to the connection pool.
-func (db *DB) Close() error {
-	err := db.master.Close()
-	for i := range db.readreplicas {
-		err = db.readreplicas[i].Close()
+	ctx = orBackground(ctx)
+	if opts != nil && opts.ReadOnly && !db.readsOnMaster(ctx) {
+		return db.beginOnReplicas(ctx, opts)
 	}
-	return err
+	tx, err := db.master.BeginTx(ctx, opts)
+	return tx, db.masterError("begin", err)
 }
 
 // Exec executes a query without returning any rows.
@@ -204,15 +579,76 @@ func (db *DB) Close() error {
 //
 // Exec perform the query the on master db
 func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
-	return db.ExecContext(context.Background(), query, args...)
+	ctx, cancel := db.defaultContext()
+	defer cancel()
+	return db.ExecContext(ctx, query, args...)
 }
 
 // ExecContext executes a query without returning any rows.
 // The args are for any placeholder parameters in the query.
 //
-// ExecContext perform the query the on master db
+// ExecContext perform the query the on master db,
+// or on read replicas when ctx is returned by WithReadOnlyExec but not by WithMaster
 func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	return db.master.ExecContext(ctx, query, args...)
+	ctx = orBackground(ctx)
+	start := db.beforeQuery(ctx, query)
+	result, err := db.exec(ctx, query, args)
+	db.afterQuery(ctx, query, err, start)
+	return result, err
+}
+
+// exec executes a query without returning any rows on the node it is routed to, see ExecContext
+func (db *DB) exec(ctx context.Context, query string, args []interface{}) (sql.Result, error) {
+	db.beforeCall(ctx)
+	if err := db.checkLength(query); err != nil {
+		return nil, err
+	}
+	if readOnlyExec(ctx) && !db.readsOnMaster(ctx) {
+		return db.execOnReplicas(ctx, query, args)
+	}
+	return db.execOnMaster(ctx, masterNode, db.master, query, args)
+}
+
+// execOnMaster executes an exec on master, the node named node
+func (db *DB) execOnMaster(ctx context.Context, node string, master *sql.DB, query string, args []interface{}) (sql.Result, error) {
+	if db.observer != nil && instrumented(ctx) {
+		db.observer.OnMasterExec()
+	}
+	start := time.Now()
+	var result sql.Result
+	err := db.retryWrite(ctx, func() error {
+		var err error
+		result, err = db.execOn(ctx, node, master, query, args)
+		return err
+	})
+	db.record(ctx, start, node, query, args, err)
+	return result, db.masterError("exec", err)
+}
+
+// execOnReplicas executes a read-only exec on read replicas, with failover
+func (db *DB) execOnReplicas(ctx context.Context, query string, args []interface{}) (sql.Result, error) {
+	start := time.Now()
+	order, err := db.readOrderFor(ctx)
+	if err != nil {
+		db.record(ctx, start, "", query, args, err)
+		return nil, err
+	}
+	var result sql.Result
+	res := db.tryReplicas(ctx, order, err, replicaRead{
+		query: query,
+		args:  args,
+		attempt: func(r candidate) error {
+			var err error
+			result, err = r.db.ExecContext(ctx, query, args...)
+			return err
+		},
+	})
+	if res.err != nil {
+		db.record(ctx, start, "", query, args, res.err)
+		return nil, res.err
+	}
+	db.record(ctx, start, replicaNode(res.served.index), query, args, nil)
+	return result, nil
 }
 
 // Prepare creates a prepared statement for later queries or executions.
@@ -222,7 +658,9 @@ func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}
 // Prepare execute operation according to query. If query is for retrival of the data
 // it will prepare statement on replica db, else it will be created on master db
 func (db *DB) Prepare(query string) (*sql.Stmt, error) {
-	return db.PrepareContext(context.Background(), query)
+	ctx, cancel := db.defaultContext()
+	defer cancel()
+	return db.PrepareContext(ctx, query)
 }
 
 // PrepareContext creates a prepared statement for later queries or executions.
@@ -231,45 +669,107 @@ func (db *DB) Prepare(query string) (*sql.Stmt, error) {
 //
 // PrepareContext execute operation according to query. If query is for retrival of the data
 // it will prepare statement on replica db, else it will be created on master db
+//
+// With WithStmtCache, the statement is taken from the statement cache of the node, so repeated
+// calls for the same query share the statement prepared on it. Closing the returned statement
+// hands it back to the cache then, see WithStmtCache.
 func (db *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx = orBackground(ctx)
+	start := db.beforeQuery(ctx, query)
+	if db.cachedStmts != nil && instrumented(ctx) {
+		stmt, err := db.prepareCached(ctx, query)
+		db.afterQuery(ctx, query, err, start)
+		return stmt, err
+	}
+	p, err := db.prepareContext(ctx, query, false)
+	db.afterQuery(ctx, query, err, start)
+	return p.stmt, err
+}
+
+// prepared is a statement along with the node it is prepared on
+type prepared struct {
+	stmt *sql.Stmt
+	node string
+	// entry is set when stmt is owned by a statement cache
+	entry *cachedStmt
+	// replica is the replica stmt is prepared on, nil for master
+	replica *replica
+}
+
+// prepareContext prepares the statement, looking it up in the statement caches when useCache is set
+func (db *DB) prepareContext(ctx context.Context, query string, useCache bool) (prepared, error) {
+	db.beforeCall(ctx)
+	if err := db.checkLength(query); err != nil {
+		return prepared{}, err
+	}
 	// All the data retrival queries will be execute on replicas
 	// If query is not for data retrival then only it is allow to execute on master db
-	qSmall := strings.ToLower(strings.TrimSpace(query))
-	if !strings.HasPrefix(qSmall, "select") {
-		return db.master.PrepareContext(ctx, query)
+	start := time.Now()
+	if !db.isReadQuery(query) || db.readsOnMaster(ctx) {
+		var p prepared
+		err := db.retry(ctx, func() error {
+			var err error
+			p.stmt, p.entry, err = prepareOn(ctx, db.master, cacheIf(useCache, db.masterStmts), query)
+			return err
+		})
+		p.node = masterNode
+		db.slowQuery(ctx, start, p.node, query, nil)
+		return p, db.masterError("prepare", err)
 	}
-	return db.prepare(ctx, query)
+	p, err := db.prepare(ctx, query, useCache)
+	db.slowQuery(ctx, start, p.node, query, nil)
+	return p, err
 }
 
-func (db *DB) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
-	replicaIndex := db.readReplicaNumberRoundRobin()
-	stmt, err := db.readreplicas[replicaIndex].PrepareContext(ctx, query)
-	if err == nil {
-		return stmt, err
+func (db *DB) prepare(ctx context.Context, query string, useCache bool) (prepared, error) {
+	if tx := db.activeTx(ctx); tx != nil {
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != sql.ErrTxDone {
+			return prepared{stmt: stmt, node: masterNode}, err
+		}
+	}
+	hash, keyed := routingKeyOf(ctx)
+	order, err := db.readOrderKeyed(hash, keyed)
+	if err != nil && !db.lagFallback(err) {
+		return prepared{}, err
+	}
+	// the routing key of the caller beats the replica which recently prepared the query
+	if replicaIndex, ok := db.prepareAffinity.lookup(query); ok && !keyed {
+		order = preferFirst(order, replicaIndex)
 	}
+	// the replica pinned by the caller beats the one which recently prepared the query
+	order = preferPinned(ctx, order)
 	// if selected replica is down or not alive for read request, Algorithm will select next available replica
 	// for reading data in below lines
 	// If all replicas are closed or not alive then error is return  "noReplicaAvailableError"
-	for i := replicaIndex + 1; ; i++ {
-		newIndex := i % len(db.readreplicas)
-		if newIndex == replicaIndex {
-			return nil, errors.New(noReplicaAvailableError)
-		}
-		stmt, err := db.readreplicas[newIndex].PrepareContext(ctx, query)
-		if err == nil {
-			return stmt, err
-		}
+	var stmt *sql.Stmt
+	var entry *cachedStmt
+	res := db.tryReplicas(ctx, order, err, replicaRead{
+		query: query,
+		attempt: func(r candidate) error {
+			var err error
+			stmt, entry, err = prepareOn(ctx, r.db, cacheIf(useCache, r.stmts), query)
+			return err
+		},
+		fallback: true,
+	})
+	if res.err == nil {
+		db.prepareAffinity.remember(query, res.served.index)
+		return prepared{stmt: stmt, node: replicaNode(res.served.index), entry: entry, replica: res.served.replica}, nil
+	}
+	if res.fallback {
+		stmt, entry, err := prepareOn(ctx, db.master, cacheIf(useCache, db.masterStmts), query)
+		return prepared{stmt: stmt, node: masterNode, entry: entry}, err
 	}
+	return prepared{}, res.err
 }
 
 // SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
 //
 // If d <= 0, connections are reused forever.
 func (db *DB) SetConnMaxLifetime(d time.Duration) {
-	db.master.SetConnMaxLifetime(d)
-	for i := range db.readreplicas {
-		db.readreplicas[i].SetConnMaxLifetime(d)
-	}
+	db.SetMasterConnMaxLifetime(d)
+	db.SetReplicasConnMaxLifetime(d)
 }
 
 // SetMaxIdleConns sets the maximum number of connections in the idle
@@ -280,10 +780,8 @@ func (db *DB) SetConnMaxLifetime(d time.Duration) {
 // The default max idle connections is currently 2. This may change in
 // a future release.
 func (db *DB) SetMaxIdleConns(n int) {
-	db.master.SetMaxIdleConns(n)
-	for i := range db.readreplicas {
-		db.readreplicas[i].SetMaxIdleConns(n)
-	}
+	db.SetMasterMaxIdleConns(n)
+	db.SetReplicasMaxIdleConns(n)
 }
 
 // SetMaxOpenConns sets the maximum number of open connections to the database.
@@ -291,8 +789,6 @@ func (db *DB) SetMaxIdleConns(n int) {
 // If n <= 0, then there is no limit on the number of open connections.
 // The default is 0 (unlimited).
 func (db *DB) SetMaxOpenConns(n int) {
-	db.master.SetMaxOpenConns(n)
-	for i := range db.readreplicas {
-		db.readreplicas[i].SetMaxOpenConns(n)
-	}
+	db.SetMasterMaxOpenConns(n)
+	db.SetReplicasMaxOpenConns(n)
 }
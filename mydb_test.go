@@ -1,6 +1,10 @@
 package mydb
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
 	"strconv"
 	"testing"
 	"time"
@@ -9,6 +13,12 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+func TestMain(m *testing.M) {
+	// the tests expect the round robin to start at the first replica
+	roundRobinStart = func(*DB, int) int { return 0 }
+	os.Exit(m.Run())
+}
+
 func TestDB_Ping(t *testing.T) {
 	masterDB, _, err := sqlmock.New()
 	if err != nil {
@@ -40,6 +50,13 @@ func TestDB_Ping(t *testing.T) {
 	err = db.Ping()
 	assert.NotNil(t, err)
 	assert.Equal(t, err.Error(), "master's db ping fail: sql: database is closed\nreplica db 1 ping fail: sql: database is closed")
+
+	// replicas are checked independently of master
+	assert.NotNil(t, db.PingMaster(context.Background()))
+	errs := db.PingReplicas(context.Background())
+	assert.Len(t, errs, 2)
+	assert.Equal(t, errs[0].Error(), "replica db 1 ping fail: sql: database is closed")
+	assert.Nil(t, errs[1])
 }
 
 func TestDB_Query(t *testing.T) {
@@ -96,6 +113,25 @@ func TestDB_Query(t *testing.T) {
 	assert.Equal(t, err.Error(), noReplicaAvailableError)
 }
 
+func TestDB_QuerySingleReplica(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1)
+	assert.Nil(t, err)
+	// the error of the only replica is returned as is
+	mock1.ExpectQuery("Query1").WillReturnError(errors.New("syntax error"))
+	rs, err := db.Query("Query1")
+	assert.Nil(t, rs)
+	assert.Equal(t, err.Error(), "syntax error")
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
+
 func TestDB_QueryRow(t *testing.T) {
 	masterDB, _, err := sqlmock.New()
 	if err != nil {
@@ -111,6 +147,41 @@ func TestDB_QueryRow(t *testing.T) {
 	assert.NotNil(t, rows)
 }
 
+func TestDB_QueryRowErrFailover(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+
+	// the replica is failed over, the missing row is left to Scan
+	mock2.ExpectQuery("Query1").WillReturnError(sql.ErrConnDone)
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	row, err := db.QueryRowErr(context.Background(), "Query1")
+	assert.Nil(t, err)
+	var col1 string
+	assert.Equal(t, row.Scan(&col1), sql.ErrNoRows)
+
+	// every replica fails, the error is returned right away
+	mock1.ExpectQuery("Query2").WillReturnError(sql.ErrConnDone)
+	mock2.ExpectQuery("Query2").WillReturnError(sql.ErrConnDone)
+	row, err = db.QueryRowErr(context.Background(), "Query2")
+	assert.True(t, errors.Is(err, sql.ErrConnDone))
+	assert.True(t, errors.Is(row.Scan(&col1), sql.ErrConnDone))
+
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
 func TestDB_Exec(t *testing.T) {
 	masterDB, mock, err := sqlmock.New()
 	if err != nil {
@@ -220,6 +291,11 @@ func TestDB_New(t *testing.T) {
 	_, err = New(masterDB)
 	assert.NotNil(t, err)
 	assert.Equal(t, err.Error(), noReadReplicaError)
+	_, err = New(nil, replica1)
+	assert.Equal(t, err, ErrNilMaster)
+	_, err = New(masterDB, replica1, nil)
+	assert.True(t, errors.Is(err, ErrNilReplica))
+	assert.Equal(t, err.Error(), "replica db 2 is nil: replica db must not be nil")
 }
 func TestDB_Close(t *testing.T) {
 	masterDB, mock, err := sqlmock.New()
@@ -257,3 +333,118 @@ func TestDB_SetConnMaxLifetime(t *testing.T) {
 	db.SetConnMaxLifetime(time.Hour * 24)
 	db.SetMaxOpenConns(30)
 }
+
+func TestDB_QuerySystemicFailure(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica3, mock3, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1, replica2, replica3)
+	assert.Nil(t, err)
+
+	// the same error on two replicas stops the failover and is returned as is
+	mock2.ExpectQuery("Query1").WillReturnError(errors.New(`relation "t" does not exist`))
+	mock3.ExpectQuery("Query1").WillReturnError(errors.New(`relation "t" does not exist`))
+	_, err = db.Query("Query1")
+	assert.Equal(t, err.Error(), `relation "t" does not exist`)
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+	assert.Nil(t, mock3.ExpectationsWereMet())
+
+	// replicas being down is not a systemic failure
+	replica3.Close()
+	replica1.Close()
+	mock2.ExpectQuery("Query2").WillReturnError(errors.New("timeout"))
+	_, err = db.Query("Query2")
+	assert.True(t, errors.Is(err, ErrNoReplicaAvailable))
+	assert.Equal(t, err.Error(), noReplicaAvailableError)
+	assert.Nil(t, mock2.ExpectationsWereMet())
+
+	// the error of every replica tried is kept
+	var noReplica *NoReplicaAvailableError
+	assert.True(t, errors.As(err, &noReplica))
+	assert.Len(t, noReplica.Errs, 3)
+	var replicaErr *ReplicaError
+	assert.True(t, errors.As(noReplica.Errs[2], &replicaErr))
+	assert.Equal(t, replicaErr.Index, 1)
+	assert.Equal(t, replicaErr.Error(), "replica db 2 read fail: timeout")
+}
+
+func TestDB_CanceledContext(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2})
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// no replica is tried once the caller gave up
+	_, err = db.QueryContext(ctx, "Query1")
+	assert.Equal(t, err, context.Canceled)
+	_, err = db.QueryRowErr(WithQueryRowStrategy(ctx, QueryRowFailover), "Query1")
+	assert.Equal(t, err, context.Canceled)
+	_, err = db.PrepareContext(ctx, "Select1")
+	assert.Equal(t, err, context.Canceled)
+	_, err = db.ExecContext(WithReadOnlyExec(ctx), "Call1")
+	assert.Equal(t, err, context.Canceled)
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
+func TestDB_QueryTriesEachReplicaOnce(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicas := make([]*sql.DB, 3)
+	mocks := make([]sqlmock.Sqlmock, 3)
+	for i := range replicas {
+		if replicas[i], mocks[i], err = sqlmock.New(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var failovers int
+	db, err := NewWithOptions(masterDB, replicas, WithOnFailover(func(FailoverEvent) {
+		failovers++
+	}))
+	assert.Nil(t, err)
+
+	// closed or failing replicas are not tried again
+	replicas[0].Close()
+	mocks[1].ExpectQuery("Query1").WillReturnError(sql.ErrConnDone)
+	mocks[2].ExpectQuery("Query1").WillReturnError(errors.New("down"))
+	_, err = db.Query("Query1")
+	assert.True(t, errors.Is(err, ErrNoReplicaAvailable))
+	var noReplica *NoReplicaAvailableError
+	assert.True(t, errors.As(err, &noReplica))
+	tried := map[int]bool{}
+	for _, err := range noReplica.Errs {
+		tried[err.(*ReplicaError).Index] = true
+	}
+	assert.Equal(t, tried, map[int]bool{0: true, 1: true, 2: true})
+	assert.Equal(t, failovers, 2)
+	assert.Nil(t, mocks[1].ExpectationsWereMet())
+	assert.Nil(t, mocks[2].ExpectationsWereMet())
+}
@@ -0,0 +1,46 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// NewNamed returns a new instance of library handle i.e. DB
+// whose read replicas are named, so that QueryOn can target one of them.
+// The replicas are indexed in the order of their names.
+// at least one read replica instance is expected
+func NewNamed(master *sql.DB, readreplicas map[string]*sql.DB, opts ...Option) (*DB, error) {
+	configs := make([]ReplicaConfig, 0, len(readreplicas))
+	for name, r := range readreplicas {
+		configs = append(configs, ReplicaConfig{DB: r, Name: name})
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].Name < configs[j].Name
+	})
+	return NewWithReplicas(master, configs, opts...)
+}
+
+// ReplicaNames returns the names of the replicas in index order,
+// the name of a replica given without a name is empty.
+func (db *DB) ReplicaNames() []string {
+	replicas := db.replicas()
+	names := make([]string, len(replicas))
+	for i, r := range replicas {
+		names[i] = r.name
+	}
+	return names
+}
+
+// QueryOn executes a query on the replica named name, without any balancing or failover,
+// like QueryOnReplica does. An error is returned if no replica has that name.
+func (db *DB) QueryOn(ctx context.Context, name string, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx = orBackground(ctx)
+	for i, r := range db.replicas() {
+		if name != "" && r.name == name {
+			return db.queryOnReplica(ctx, i, r, query, args)
+		}
+	}
+	return nil, fmt.Errorf(unknownReplicaNameError, name)
+}
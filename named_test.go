@@ -0,0 +1,46 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_QueryOn(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewNamed(masterDB, map[string]*sql.DB{"us-east": replica2, "eu-west": replica1})
+	assert.Nil(t, err)
+	assert.Equal(t, db.ReplicaNames(), []string{"eu-west", "us-east"})
+
+	mock2.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.QueryOn(context.Background(), "us-east", "Query1")
+	assert.Nil(t, err)
+	_, err = db.QueryOn(context.Background(), "ap-south", "Query1")
+	assert.Equal(t, err.Error(), `no replica is named "ap-south"`)
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+
+	_, err = NewNamed(masterDB, nil)
+	assert.Equal(t, err, ErrNoReadReplica)
+
+	// replicas of New are unnamed
+	db, err = New(masterDB, replica1)
+	assert.Nil(t, err)
+	assert.Equal(t, db.ReplicaNames(), []string{""})
+	_, err = db.QueryOn(context.Background(), "", "Query1")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,115 @@
+package mydb
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// newNamedStmts returns the registered statements of a node, keyed by name.
+// They are not bounded, every registered statement stays prepared till the node is cleared.
+func newNamedStmts() *stmtCache {
+	return &stmtCache{
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// prepareNamed returns the statement registered as name prepared on conn, preparing query the first time.
+// The caller must release the returned statement.
+func prepareNamed(ctx context.Context, conn *sql.DB, named *stmtCache, name string, query string) (*cachedStmt, error) {
+	if entry := named.get(name); entry != nil {
+		return entry, nil
+	}
+	stmt, err := conn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return named.put(name, stmt), nil
+}
+
+// Register registers query as name, for NamedStmt to prepare it. A name can be registered once.
+func (db *DB) Register(name string, query string) error {
+	if name == "" {
+		return ErrEmptyStmtName
+	}
+	db.registeredMu.Lock()
+	defer db.registeredMu.Unlock()
+	if _, ok := db.registered[name]; ok {
+		return fmt.Errorf(stmtRegisteredError, name)
+	}
+	if db.registered == nil {
+		db.registered = make(map[string]string)
+	}
+	db.registered[name] = query
+	return nil
+}
+
+// NamedStmt returns the statement registered as name with Register, prepared where PrepareContext
+// would prepare it: on a replica picked by the balancer, with failover, for reads, on master otherwise.
+// A statement is prepared once per node and shared by the following calls picking the same node.
+// The statements of a replica are prepared again once it was removed or marked down by the health check.
+//
+// The caller must Close the statement when done with it, which hands it back rather than closing it:
+// the statement is closed once it is no longer prepared on its node and every caller closed it.
+func (db *DB) NamedStmt(ctx context.Context, name string) (*Stmt, error) {
+	ctx = orBackground(ctx)
+	db.registeredMu.RLock()
+	query, ok := db.registered[name]
+	db.registeredMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf(unknownStmtError, name)
+	}
+	db.beforeCall(ctx)
+	if !db.isReadQuery(query) || db.readsOnMaster(ctx) {
+		entry, err := prepareNamed(ctx, db.master, db.masterNamed, name, query)
+		if err != nil {
+			return nil, db.masterError("prepare", err)
+		}
+		return db.namedStmt(ctx, query, entry, masterNode, nil), nil
+	}
+	order, err := db.readOrderFor(ctx)
+	if err != nil && !db.lagFallback(err) {
+		return nil, err
+	}
+	var entry *cachedStmt
+	res := db.tryReplicas(ctx, order, err, replicaRead{
+		query: query,
+		attempt: func(r candidate) error {
+			var err error
+			entry, err = prepareNamed(ctx, r.db, r.named, name, query)
+			return err
+		},
+		fallback: true,
+	})
+	if res.fallback {
+		entry, err := prepareNamed(ctx, db.master, db.masterNamed, name, query)
+		if err != nil {
+			return nil, err
+		}
+		return db.namedStmt(ctx, query, entry, masterNode, nil), nil
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	return db.namedStmt(ctx, query, entry, replicaNode(res.served.index), res.served.replica), nil
+}
+
+// namedStmt wraps entry, a registered statement prepared on node, into the *Stmt handed to the caller
+func (db *DB) namedStmt(ctx context.Context, query string, entry *cachedStmt, node string, r *replica) *Stmt {
+	s := &Stmt{
+		Stmt:     entry.stmt,
+		db:       db,
+		query:    query,
+		node:     node,
+		prepared: time.Now(),
+		entry:    entry,
+		replica:  r,
+	}
+	if instrumented(ctx) {
+		s.onClose = db.onStmtClose
+	}
+	return s
+}
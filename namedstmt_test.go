@@ -0,0 +1,72 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_NamedStmt(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Register("user", "SELECT name FROM users"))
+	assert.Nil(t, db.Register("rename", "UPDATE users SET name = ?"))
+	assert.Equal(t, db.Register("user", "SELECT 1").Error(), `a statement is already registered as "user"`)
+	assert.Equal(t, db.Register("", "SELECT 1"), ErrEmptyStmtName)
+	ctx := context.Background()
+
+	// prepared once per node
+	mock2.ExpectPrepare("SELECT name FROM users").WillBeClosed()
+	mock1.ExpectPrepare("SELECT name FROM users").WillReturnError(sql.ErrConnDone)
+	mock2.ExpectPrepare("SELECT name FROM users")
+	mock.ExpectPrepare("UPDATE users")
+	var stmts []*Stmt
+	for i := 0; i < 2; i++ {
+		stmt, err := db.NamedStmt(ctx, "user")
+		assert.Nil(t, err)
+		stmts = append(stmts, stmt)
+	}
+	// replica2 was picked, then replica1 failed over to it
+	assert.Equal(t, stmts[0].Stmt, stmts[1].Stmt)
+	assert.Equal(t, stmts[1].Node(), "replica-1")
+	for i := 0; i < 2; i++ {
+		stmt, err := db.NamedStmt(ctx, "rename")
+		assert.Nil(t, err)
+		assert.Nil(t, stmt.Close())
+	}
+	assert.Nil(t, stmts[1].Close())
+
+	// the statements of a replica are prepared again once cleared, as the health check does when it goes down
+	db.readreplicas[1].named.clear()
+	stmt, err := db.NamedStmt(ctx, "user")
+	assert.Nil(t, err)
+	assert.Nil(t, stmt.Close())
+
+	// the statement still in use keeps working, it is closed once handed back
+	mock2.ExpectQuery("SELECT name FROM users").WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("alice"))
+	var name string
+	assert.Nil(t, stmts[0].QueryRowContext(ctx).Scan(&name))
+	assert.Equal(t, name, "alice")
+	assert.Nil(t, stmts[0].Close())
+
+	_, err = db.NamedStmt(ctx, "missing")
+	assert.Equal(t, err.Error(), `no statement is registered as "missing"`)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
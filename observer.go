@@ -0,0 +1,58 @@
+package mydb
+
+import "time"
+
+// Observer receives metric events from DB, e.g. to feed Prometheus counters
+// without mydb depending on any metrics library.
+// Embed NopObserver to implement only the events you are interested in.
+type Observer interface {
+	// OnStaleRead is called when a read is served by a replica lagging behind
+	// master more than the threshold set with WithStaleReadThreshold.
+	OnStaleRead(lag time.Duration)
+	// OnPoolSaturated is called by the pool monitor when the connections in use of
+	// node ("master" or "replica-<index>") reach its MaxOpenConns limit.
+	OnPoolSaturated(node string)
+	// OnFirstRow is called by QueryStream with the time node took to return the first row.
+	OnFirstRow(node string, d time.Duration)
+	// OnQueryTiming is called, when acquisition timing is enabled with WithAcquisitionTiming,
+	// with the time a query waited for a pooled connection of node and the time it then took to execute.
+	OnQueryTiming(node string, acquire, exec time.Duration)
+	// OnQueryRouted is called every time a read or a prepare is served by the replica at index.
+	OnQueryRouted(index int)
+	// OnFailover is called every time a read fails on the replica at index from
+	// and is retried on the replica at index to.
+	OnFailover(from, to int)
+	// OnMasterExec is called for every exec sent to master.
+	OnMasterExec()
+}
+
+// NopObserver is an Observer ignoring every event.
+type NopObserver struct{}
+
+// OnStaleRead implements Observer
+func (NopObserver) OnStaleRead(lag time.Duration) {}
+
+// OnPoolSaturated implements Observer
+func (NopObserver) OnPoolSaturated(node string) {}
+
+// OnFirstRow implements Observer
+func (NopObserver) OnFirstRow(node string, d time.Duration) {}
+
+// OnQueryTiming implements Observer
+func (NopObserver) OnQueryTiming(node string, acquire, exec time.Duration) {}
+
+// OnQueryRouted implements Observer
+func (NopObserver) OnQueryRouted(index int) {}
+
+// OnFailover implements Observer
+func (NopObserver) OnFailover(from, to int) {}
+
+// OnMasterExec implements Observer
+func (NopObserver) OnMasterExec() {}
+
+// WithObserver registers o to receive metric events.
+func WithObserver(o Observer) Option {
+	return func(db *DB) {
+		db.observer = o
+	}
+}
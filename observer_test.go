@@ -0,0 +1,60 @@
+package mydb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingObserver records the routing events reported to it
+type countingObserver struct {
+	NopObserver
+	events []string
+}
+
+func (o *countingObserver) OnQueryRouted(index int) {
+	o.events = append(o.events, fmt.Sprintf("routed %d", index))
+}
+
+func (o *countingObserver) OnFailover(from, to int) {
+	o.events = append(o.events, fmt.Sprintf("failover %d->%d", from, to))
+}
+
+func (o *countingObserver) OnMasterExec() {
+	o.events = append(o.events, "master exec")
+}
+
+func TestObserver_RoutingEvents(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	observer := &countingObserver{}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2}, WithObserver(observer))
+	assert.Nil(t, err)
+
+	mock2.ExpectQuery("Query1").WillReturnError(errors.New("down"))
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query1")
+	assert.Nil(t, err)
+	mock1.ExpectPrepare("Select1")
+	_, err = db.Prepare("Select1")
+	assert.Nil(t, err)
+	mock.ExpectExec("Insert1").WillReturnResult(sqlmock.NewResult(1, 1))
+	_, err = db.Exec("Insert1")
+	assert.Nil(t, err)
+
+	assert.Equal(t, observer.events, []string{"failover 1->0", "routed 0", "routed 0", "master exec"})
+}
@@ -0,0 +1,33 @@
+package mydb
+
+import "math/rand"
+
+// Option configures optional behaviour of DB. Options are passed to NewWithOptions.
+type Option func(*DB)
+
+// WithRand sets the source of randomness used by the random parts of mydb
+// (random replica selection, random start offset, backoff jitter).
+// Pass a seeded source to get reproducible behaviour in tests.
+//
+// r is not required to be safe for concurrent use, DB serializes access to it.
+func WithRand(r *rand.Rand) Option {
+	return func(db *DB) {
+		if r != nil {
+			db.rnd = r
+		}
+	}
+}
+
+// randIntn returns a non-negative pseudo-random number in [0,n) drawn from the configured source.
+func (db *DB) randIntn(n int) int {
+	db.rndMu.Lock()
+	defer db.rndMu.Unlock()
+	return db.rnd.Intn(n)
+}
+
+// randFloat64 returns a pseudo-random number in [0.0,1.0) drawn from the configured source.
+func (db *DB) randFloat64() float64 {
+	db.rndMu.Lock()
+	defer db.rndMu.Unlock()
+	return db.rnd.Float64()
+}
@@ -0,0 +1,34 @@
+package mydb
+
+import (
+	"database/sql"
+	"math/rand"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithOptions_WithRand(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db1, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithRand(rand.New(rand.NewSource(42))))
+	assert.Nil(t, err)
+	db2, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithRand(rand.New(rand.NewSource(42))))
+	assert.Nil(t, err)
+	// same seed gives same sequence
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, db1.randIntn(100), db2.randIntn(100))
+	}
+
+	_, err = NewWithOptions(masterDB, nil, WithRand(rand.New(rand.NewSource(42))))
+	assert.NotNil(t, err)
+	assert.Equal(t, err.Error(), noReadReplicaError)
+}
@@ -0,0 +1,182 @@
+package mydb
+
+import (
+	"database/sql"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMaxIdleConns is the max idle connections of a sql.DB unless set
+const defaultMaxIdleConns = 2
+
+// NodePoolConfig is the connection pool configuration of a node.
+type NodePoolConfig struct {
+	// Node is "master" or "replica-<index>"
+	Node string
+	// MaxOpenConns is the maximum number of open connections, 0 means unlimited
+	MaxOpenConns int
+	// MaxIdleConns is the effective maximum number of idle connections, i.e. as set
+	// through DB, capped by MaxOpenConns
+	MaxIdleConns int
+}
+
+// PoolConfig is the connection pool configuration of every node, see DB.PoolConfig.
+type PoolConfig struct {
+	Master NodePoolConfig
+	// Replicas are in index order
+	Replicas []NodePoolConfig
+}
+
+// Stats returns the connection pool statistics of master and of every read replica.
+// Replica stats are in index order, i.e. the order replicas were passed to New,
+// the returned slice is owned by the caller.
+func (db *DB) Stats() (master sql.DBStats, replicas []sql.DBStats) {
+	current := db.replicas()
+	replicas = make([]sql.DBStats, len(current))
+	for i, r := range current {
+		replicas[i] = r.db.Stats()
+	}
+	return db.master.Stats(), replicas
+}
+
+// SetMasterMaxIdleConns sets the maximum number of connections in the idle connection pool of master.
+//
+// If n <= 0, no idle connections are retained.
+func (db *DB) SetMasterMaxIdleConns(n int) {
+	db.master.SetMaxIdleConns(n)
+	atomic.StoreInt64(&db.masterMaxIdle, int64(n))
+}
+
+// SetReplicaMaxIdleConns sets the maximum number of connections in the idle connection pool
+// of the replica at index, in the order passed to New.
+//
+// If n <= 0, no idle connections are retained.
+func (db *DB) SetReplicaMaxIdleConns(index, n int) error {
+	r, err := db.replicaAt(index)
+	if err != nil {
+		return err
+	}
+	r.setMaxIdleConns(n)
+	return nil
+}
+
+func (r *replica) setMaxIdleConns(n int) {
+	r.db.SetMaxIdleConns(n)
+	atomic.StoreInt64(&r.maxIdle, int64(n))
+}
+
+// SetReplicasMaxIdleConns sets the maximum number of connections in the idle connection pool
+// of every replica, leaving master unchanged.
+//
+// If n <= 0, no idle connections are retained.
+func (db *DB) SetReplicasMaxIdleConns(n int) {
+	for _, r := range db.replicas() {
+		r.setMaxIdleConns(n)
+	}
+}
+
+// SetMasterMaxOpenConns sets the maximum number of open connections to master.
+//
+// If n <= 0, then there is no limit on the number of open connections.
+func (db *DB) SetMasterMaxOpenConns(n int) {
+	db.master.SetMaxOpenConns(n)
+}
+
+// SetReplicasMaxOpenConns sets the maximum number of open connections to every replica,
+// leaving master unchanged.
+//
+// If n <= 0, then there is no limit on the number of open connections.
+func (db *DB) SetReplicasMaxOpenConns(n int) {
+	for _, r := range db.replicas() {
+		r.db.SetMaxOpenConns(n)
+	}
+}
+
+// SetMasterConnMaxLifetime sets the maximum amount of time a connection to master may be reused.
+//
+// If d <= 0, connections are reused forever.
+func (db *DB) SetMasterConnMaxLifetime(d time.Duration) {
+	db.master.SetConnMaxLifetime(d)
+}
+
+// SetReplicasConnMaxLifetime sets the maximum amount of time a connection to a replica may be reused,
+// leaving master unchanged.
+//
+// If d <= 0, connections are reused forever.
+func (db *DB) SetReplicasConnMaxLifetime(d time.Duration) {
+	for _, r := range db.replicas() {
+		r.db.SetConnMaxLifetime(d)
+	}
+}
+
+// PoolConfig returns the effective connection pool configuration of every node.
+// database/sql doesn't expose the idle setting, so the idle connections set on the
+// *sql.DB before it was handed to mydb are not reported, the database/sql default is instead.
+func (db *DB) PoolConfig() PoolConfig {
+	current := db.replicas()
+	config := PoolConfig{
+		Master:   nodePoolConfig(masterNode, db.master, atomic.LoadInt64(&db.masterMaxIdle)),
+		Replicas: make([]NodePoolConfig, len(current)),
+	}
+	for i, r := range current {
+		config.Replicas[i] = nodePoolConfig(replicaNode(i), r.db, atomic.LoadInt64(&r.maxIdle))
+	}
+	return config
+}
+
+// nodePoolConfig returns the pool configuration of conn, with maxIdle idle connections set
+func nodePoolConfig(node string, conn *sql.DB, maxIdle int64) NodePoolConfig {
+	config := NodePoolConfig{Node: node, MaxOpenConns: conn.Stats().MaxOpenConnections, MaxIdleConns: int(maxIdle)}
+	// mirror the capping done by database/sql
+	if config.MaxIdleConns < 0 {
+		config.MaxIdleConns = 0
+	}
+	if config.MaxOpenConns > 0 && config.MaxIdleConns > config.MaxOpenConns {
+		config.MaxIdleConns = config.MaxOpenConns
+	}
+	return config
+}
+
+// StartPoolMonitor samples the connection pool of every node each interval and reports,
+// through Observer.OnPoolSaturated, the nodes whose connections in use reached
+// threshold times their MaxOpenConns limit, e.g. 0.9 for 90%.
+// Nodes without a MaxOpenConns limit are never saturated.
+//
+// Calling it again restarts the monitor with the new settings.
+func (db *DB) StartPoolMonitor(interval time.Duration, threshold float64) {
+	db.m.Lock()
+	defer db.m.Unlock()
+	db.poolMonitor.Stop()
+	db.poolMonitor = startLoop(db.clock, interval, func() {
+		db.checkPoolSaturation(threshold)
+	})
+}
+
+// StopPoolMonitor stops the monitor started by StartPoolMonitor.
+func (db *DB) StopPoolMonitor() {
+	db.m.Lock()
+	defer db.m.Unlock()
+	db.poolMonitor.Stop()
+	db.poolMonitor = nil
+}
+
+// checkPoolSaturation reports every node whose pool is saturated
+func (db *DB) checkPoolSaturation(threshold float64) {
+	if db.observer == nil {
+		return
+	}
+	stats := db.master.Stats()
+	if poolSaturated(stats.InUse, stats.MaxOpenConnections, threshold) {
+		db.observer.OnPoolSaturated(masterNode)
+	}
+	for i, r := range db.replicas() {
+		stats = r.db.Stats()
+		if poolSaturated(stats.InUse, stats.MaxOpenConnections, threshold) {
+			db.observer.OnPoolSaturated(replicaNode(i))
+		}
+	}
+}
+
+func poolSaturated(inUse, maxOpen int, threshold float64) bool {
+	return maxOpen > 0 && float64(inUse) >= threshold*float64(maxOpen)
+}
@@ -0,0 +1,160 @@
+package mydb
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// saturatedPools records the saturated nodes reported to it
+type saturatedPools struct {
+	NopObserver
+	m     sync.Mutex
+	nodes []string
+}
+
+func (o *saturatedPools) OnPoolSaturated(node string) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.nodes = append(o.nodes, node)
+}
+
+func (o *saturatedPools) reported() []string {
+	o.m.Lock()
+	defer o.m.Unlock()
+	return append([]string(nil), o.nodes...)
+}
+
+func TestDB_PoolMonitor(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	observer := &saturatedPools{}
+	clk := newFakeClock()
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithObserver(observer), withClock(clk))
+	assert.Nil(t, err)
+
+	// replica1 has a single connection, which is held by a transaction
+	replica1.SetMaxOpenConns(1)
+	mock1.ExpectBegin()
+	tx, err := replica1.Begin()
+	assert.Nil(t, err)
+
+	db.checkPoolSaturation(1)
+	assert.Equal(t, observer.reported(), []string{"replica-0"})
+
+	// the monitor checks the pools every interval
+	db.StartPoolMonitor(time.Minute, 1)
+	for i := 0; i < 2; i++ {
+		clk.wait(1)
+		clk.advance(time.Minute)
+	}
+	// the check is over once the next one is scheduled
+	clk.wait(1)
+	db.StopPoolMonitor()
+	reported := len(observer.reported())
+	assert.Equal(t, reported, 3)
+	// and stops with the monitor
+	clk.advance(time.Minute)
+	assert.Equal(t, len(observer.reported()), reported)
+
+	mock1.ExpectRollback()
+	assert.Nil(t, tx.Rollback())
+	db.checkPoolSaturation(1)
+	assert.Equal(t, len(observer.reported()), reported)
+}
+
+func TestDB_Stats(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	masterDB.SetMaxOpenConns(3)
+	replica2.SetMaxOpenConns(5)
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+
+	master, replicas := db.Stats()
+	assert.Equal(t, master.MaxOpenConnections, 3)
+	assert.Len(t, replicas, 2)
+	assert.Equal(t, replicas[0].MaxOpenConnections, 0)
+	assert.Equal(t, replicas[1].MaxOpenConnections, 5)
+}
+
+func TestDB_PerNodeMaxIdleConns(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+
+	db.SetMaxIdleConns(4)
+	db.SetMasterMaxIdleConns(10)
+	assert.Nil(t, db.SetReplicaMaxIdleConns(1, -1))
+	assert.NotNil(t, db.SetReplicaMaxIdleConns(2, 1))
+	replica1.SetMaxOpenConns(3)
+
+	config := db.PoolConfig()
+	assert.Equal(t, config.Master, NodePoolConfig{Node: masterNode, MaxIdleConns: 10})
+	assert.Equal(t, config.Replicas, []NodePoolConfig{
+		{Node: "replica-0", MaxOpenConns: 3, MaxIdleConns: 3},
+		{Node: "replica-1", MaxIdleConns: 0},
+	})
+}
+
+func TestDB_PerRoleSetters(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+
+	db.SetMasterMaxOpenConns(20)
+	db.SetReplicasMaxOpenConns(5)
+	db.SetMasterMaxIdleConns(8)
+	db.SetReplicasMaxIdleConns(1)
+	db.SetMasterConnMaxLifetime(time.Hour)
+	db.SetReplicasConnMaxLifetime(time.Minute)
+
+	config := db.PoolConfig()
+	assert.Equal(t, config.Master, NodePoolConfig{Node: masterNode, MaxOpenConns: 20, MaxIdleConns: 8})
+	assert.Equal(t, config.Replicas, []NodePoolConfig{
+		{Node: "replica-0", MaxOpenConns: 5, MaxIdleConns: 1},
+		{Node: "replica-1", MaxOpenConns: 5, MaxIdleConns: 1},
+	})
+}
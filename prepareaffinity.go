@@ -0,0 +1,81 @@
+package mydb
+
+import (
+	"sync"
+	"time"
+)
+
+// maxPrepareAffinity bounds the number of queries remembered by the prepare affinity
+const maxPrepareAffinity = 1024
+
+// prepareAffinity remembers which replica recently prepared a query
+type prepareAffinity struct {
+	window  time.Duration
+	m       sync.Mutex
+	recents map[string]recentPrepare
+}
+
+type recentPrepare struct {
+	index int
+	at    time.Time
+}
+
+// WithPrepareAffinity makes Prepare of a read reuse the replica which prepared the same
+// query within window, as long as it is still healthy, instead of asking the balancer.
+// It improves the hit rate of replica side statement caches for callers re-preparing
+// the same queries frequently.
+func WithPrepareAffinity(window time.Duration) Option {
+	return func(db *DB) {
+		db.prepareAffinity = &prepareAffinity{
+			window:  window,
+			recents: make(map[string]recentPrepare),
+		}
+	}
+}
+
+// lookup returns the replica which recently prepared query
+func (a *prepareAffinity) lookup(query string) (int, bool) {
+	if a == nil {
+		return 0, false
+	}
+	a.m.Lock()
+	defer a.m.Unlock()
+	recent, ok := a.recents[query]
+	if !ok || time.Since(recent.at) > a.window {
+		return 0, false
+	}
+	return recent.index, true
+}
+
+// remember records replica at index prepared query
+func (a *prepareAffinity) remember(query string, index int) {
+	if a == nil {
+		return
+	}
+	a.m.Lock()
+	defer a.m.Unlock()
+	if _, ok := a.recents[query]; !ok && len(a.recents) >= maxPrepareAffinity {
+		for q, recent := range a.recents {
+			if time.Since(recent.at) > a.window {
+				delete(a.recents, q)
+			}
+		}
+		if len(a.recents) >= maxPrepareAffinity {
+			a.recents = make(map[string]recentPrepare)
+		}
+	}
+	a.recents[query] = recentPrepare{index: index, at: time.Now()}
+}
+
+// preferFirst moves the replica at index to the front of order, if it is part of it
+func preferFirst(order []candidate, index int) []candidate {
+	for i := range order {
+		if order[i].index == index {
+			c := order[i]
+			copy(order[1:i+1], order[:i])
+			order[0] = c
+			break
+		}
+	}
+	return order
+}
@@ -0,0 +1,69 @@
+package mydb
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_PrepareAffinity(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2}, WithPrepareAffinity(time.Minute))
+	assert.Nil(t, err)
+
+	// every prepare of Select1 sticks to replica2, which prepared it first
+	for i := 0; i < 3; i++ {
+		mock2.ExpectPrepare("Select1")
+		stmt, err := db.PrepareStmt("Select1")
+		assert.Nil(t, err)
+		assert.Equal(t, stmt.Node(), "replica-1")
+	}
+	// other queries still round robin
+	mock1.ExpectPrepare("Select2")
+	stmt, err := db.PrepareStmt("Select2")
+	assert.Nil(t, err)
+	assert.Equal(t, stmt.Node(), "replica-0")
+
+	// replica2 goes away, Select1 moves to replica1 and sticks there
+	replica2.Close()
+	mock1.ExpectPrepare("Select1")
+	mock1.ExpectPrepare("Select1")
+	for i := 0; i < 2; i++ {
+		stmt, err = db.PrepareStmt("Select1")
+		assert.Nil(t, err)
+		assert.Equal(t, stmt.Node(), "replica-0")
+	}
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
+func TestPrepareAffinity_Window(t *testing.T) {
+	a := &prepareAffinity{window: time.Minute, recents: map[string]recentPrepare{}}
+	a.remember("Select1", 1)
+	index, ok := a.lookup("Select1")
+	assert.True(t, ok)
+	assert.Equal(t, index, 1)
+
+	a.recents["Select1"] = recentPrepare{index: 1, at: time.Now().Add(-time.Hour)}
+	_, ok = a.lookup("Select1")
+	assert.False(t, ok)
+
+	var disabled *prepareAffinity
+	disabled.remember("Select1", 1)
+	_, ok = disabled.lookup("Select1")
+	assert.False(t, ok)
+}
@@ -0,0 +1,30 @@
+package mydb
+
+import "context"
+
+// ReadPreference is where the reads are served, see WithReadPreference.
+type ReadPreference int
+
+const (
+	// ReplicaOnly serves the reads by the read replicas only, a read failing on every replica fails.
+	// It is the default preference.
+	ReplicaOnly ReadPreference = iota
+	// PreferReplica serves the reads by the read replicas, and by master once every replica failed.
+	PreferReplica
+	// MasterOnly serves every read by master, e.g. in a single node development setup.
+	MasterOnly
+)
+
+// WithReadPreference sets where the reads, prepares and read-only transactions are served.
+// A single call can still be routed to master with a context returned by WithMaster,
+// whatever the preference.
+func WithReadPreference(p ReadPreference) Option {
+	return func(db *DB) {
+		db.readPreference = p
+	}
+}
+
+// readsOnMaster reports whether the reads made with ctx must be served by master
+func (db *DB) readsOnMaster(ctx context.Context) bool {
+	return db.readPreference == MasterOnly || forcedMaster(ctx)
+}
@@ -0,0 +1,58 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithReadPreference(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithReadPreference(MasterOnly))
+	assert.Nil(t, err)
+
+	// every read is served by master
+	mock.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	mock.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}).AddRow(1))
+	mock.ExpectPrepare("Select1")
+	mock.ExpectBegin()
+	_, err = db.Query("Query1")
+	assert.Nil(t, err)
+	var col1 int
+	assert.Nil(t, db.QueryRow("Query2").Scan(&col1))
+	_, err = db.Prepare("Select1")
+	assert.Nil(t, err)
+	_, err = db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	assert.Nil(t, err)
+
+	// replicas only, the read fails with the replica
+	db.readPreference = ReplicaOnly
+	mock1.ExpectQuery("Query3").WillReturnError(errors.New("down"))
+	_, err = db.Query("Query3")
+	assert.Equal(t, err.Error(), "down")
+	// unless the call is bumped to master
+	mock.ExpectQuery("Query3").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.QueryContext(WithMaster(context.Background()), "Query3")
+	assert.Nil(t, err)
+
+	// replicas first, then master
+	db.readPreference = PreferReplica
+	mock1.ExpectQuery("Query4").WillReturnError(errors.New("down"))
+	mock.ExpectQuery("Query4").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query4")
+	assert.Nil(t, err)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
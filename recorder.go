@@ -0,0 +1,65 @@
+package mydb
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// RecordedQuery is a query captured by the recorder registered with WithQueryRecorder.
+// Queries are written to the recorder one JSON object per line, so the stream can be
+// replayed later, e.g. to load test a staging cluster.
+type RecordedQuery struct {
+	// Query is the query text, as issued by the caller
+	Query string `json:"query"`
+	// Args are the query args, each of them replaced by "<redacted>"
+	// unless arg redaction is disabled with WithArgRedaction(false)
+	Args []interface{} `json:"args,omitempty"`
+	// Node is the node which executed the query, empty when no node could execute it
+	Node string `json:"node,omitempty"`
+	// Start is the time the query was issued at
+	Start time.Time `json:"start"`
+	// Duration is the time the query took to return
+	Duration time.Duration `json:"duration"`
+	// Err is the error returned by the query, if any
+	Err string `json:"error,omitempty"`
+}
+
+// queryRecorder serializes recorded queries to a writer
+type queryRecorder struct {
+	m   sync.Mutex
+	enc *json.Encoder
+}
+
+// WithQueryRecorder records every query and exec issued through the DB to w,
+// one RecordedQuery per line. Write errors are ignored, recording never fails a query.
+// Queries issued with a context returned by WithNoInstrumentation are not recorded.
+func WithQueryRecorder(w io.Writer) Option {
+	return func(db *DB) {
+		db.recorder = &queryRecorder{enc: json.NewEncoder(w)}
+	}
+}
+
+// record writes the query issued at start to the recorder, if any,
+// and reports it if it was slow, see WithSlowQueryLog
+func (db *DB) record(ctx context.Context, start time.Time, node string, query string, args []interface{}, err error) {
+	db.slowQuery(ctx, start, node, query, args)
+	if db.recorder == nil || !instrumented(ctx) {
+		return
+	}
+	recorded := RecordedQuery{
+		Query:    query,
+		Args:     db.hookArgs(args),
+		Node:     node,
+		Start:    start,
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		recorded.Err = err.Error()
+	}
+	db.recorder.m.Lock()
+	db.recorder.enc.Encode(recorded)
+	db.recorder.m.Unlock()
+}
@@ -0,0 +1,97 @@
+package mydb
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_QueryRecorder(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithQueryRecorder(&out))
+	assert.Nil(t, err)
+
+	mock1.ExpectQuery("Query1").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query1", 1)
+	assert.Nil(t, err)
+	mock.ExpectExec("Exec1").WillReturnError(errors.New("deadlock"))
+	_, err = db.Exec("Exec1")
+	assert.NotNil(t, err)
+	// not recorded
+	mock1.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.QueryContext(WithNoInstrumentation(context.Background()), "Query2")
+	assert.Nil(t, err)
+
+	dec := json.NewDecoder(&out)
+	var recorded []RecordedQuery
+	for dec.More() {
+		var q RecordedQuery
+		assert.Nil(t, dec.Decode(&q))
+		recorded = append(recorded, q)
+	}
+	assert.Len(t, recorded, 2)
+	assert.Equal(t, recorded[0].Query, "Query1")
+	assert.Equal(t, recorded[0].Node, "replica-0")
+	assert.Equal(t, recorded[0].Args, []interface{}{redactedArg})
+	assert.Equal(t, recorded[0].Err, "")
+	assert.False(t, recorded[0].Start.IsZero())
+	assert.Equal(t, recorded[1].Query, "Exec1")
+	assert.Equal(t, recorded[1].Node, masterNode)
+	assert.Equal(t, recorded[1].Err, "deadlock")
+}
+
+func TestDB_QueryRowRecordedOnce(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2}, WithQueryRecorder(&out))
+	assert.Nil(t, err)
+
+	// the failover is recorded as a single read served by replica1
+	mock2.ExpectQuery("Query1").WillReturnError(sql.ErrConnDone)
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}).AddRow(1))
+	_, err = db.QueryRowErr(context.Background(), "Query1")
+	assert.Nil(t, err)
+	// as is a read failing everywhere
+	mock1.ExpectQuery("Query2").WillReturnError(sql.ErrConnDone)
+	mock2.ExpectQuery("Query2").WillReturnError(sql.ErrConnDone)
+	_, err = db.QueryRowErr(context.Background(), "Query2")
+	assert.NotNil(t, err)
+
+	dec := json.NewDecoder(&out)
+	var recorded []RecordedQuery
+	for dec.More() {
+		var q RecordedQuery
+		assert.Nil(t, dec.Decode(&q))
+		recorded = append(recorded, q)
+	}
+	assert.Len(t, recorded, 2)
+	assert.Equal(t, recorded[0].Node, "replica-0")
+	assert.Equal(t, recorded[0].Err, "")
+	assert.Equal(t, recorded[1].Node, "")
+	assert.Equal(t, recorded[1].Err, err.Error())
+}
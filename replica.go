@@ -0,0 +1,267 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaConfig describes a read replica passed to NewWithReplicas.
+type ReplicaConfig struct {
+	DB *sql.DB
+	// StmtCacheSize overrides the statement cache size set with WithStmtCache for this replica.
+	// 0 keeps the size set with WithStmtCache, a negative value disables caching on this replica.
+	StmtCacheSize int
+	// Name identifies the replica for QueryOn, it is optional
+	Name string
+	// Priority ranks the replica for reads, e.g. to prefer the replicas of the local zone:
+	// reads go to the replicas of the highest priority, the others only serve them on failover.
+	// Replicas of the same priority share the reads through the balancer. 0 by default.
+	Priority int
+}
+
+// replica is a read replica along with its state
+type replica struct {
+	db *sql.DB
+	// stmts caches the statements prepared on this replica, nil when caching is disabled
+	stmts *stmtCache
+	// lag is the last measured replication lag in nanoseconds, accessed atomically
+	lag int64
+	// history keeps the last measured lags, nil when disabled
+	history *lagHistory
+	// weight is the share of reads of the replica, see NewWeighted
+	weight int
+	// maxIdle is the max idle connections set on the replica, accessed atomically
+	maxIdle int64
+	// down is 1 when the last health check failed, accessed atomically
+	down int32
+	// draining is 1 while the replica is drained with DrainReplica, accessed atomically
+	draining int32
+	// breaker skips the replica while it keeps failing, see WithCircuitBreaker
+	breaker breaker
+	// name is the name of the replica, empty when unnamed
+	name string
+	// latency is the moving average of the read latency in nanoseconds, 0 till measured, accessed atomically
+	latency int64
+	// named are the registered statements prepared on the replica, see NamedStmt
+	named *stmtCache
+	// priority is the rank of the replica for reads, see ReplicaConfig.Priority
+	priority int
+	// id identifies the replica for its lifetime, unlike its index
+	id uint64
+}
+
+func (db *DB) newReplica(config ReplicaConfig) *replica {
+	cacheSize := db.stmtCacheSize
+	if config.StmtCacheSize != 0 {
+		cacheSize = config.StmtCacheSize
+	}
+	return &replica{
+		id:       atomic.AddUint64(&db.lastReplicaID, 1),
+		db:       config.DB,
+		name:     config.Name,
+		priority: config.Priority,
+		stmts:    newStmtCache(cacheSize),
+		named:    newNamedStmts(),
+		lag:      unknownLag,
+		history:  newLagHistory(db.lagHistorySize),
+		weight:   1,
+		maxIdle:  defaultMaxIdleConns,
+	}
+}
+
+// replicas returns the current replica set. The returned slice must not be modified.
+// Routing a call takes one snapshot and indexes that, never db.readreplicas, so that
+// an index it computed stays valid while the replica set changes.
+func (db *DB) replicas() []*replica {
+	db.replicasMu.RLock()
+	defer db.replicasMu.RUnlock()
+	return db.readreplicas
+}
+
+// Master returns the master handle given to New, e.g. to use driver specific features.
+func (db *DB) Master() *sql.DB {
+	return db.master
+}
+
+// Replicas returns the read replica handles in index order.
+// The returned slice is a copy, modifying it does not change the replica set.
+func (db *DB) Replicas() []*sql.DB {
+	replicas := db.replicas()
+	handles := make([]*sql.DB, len(replicas))
+	for i, r := range replicas {
+		handles[i] = r.db
+	}
+	return handles
+}
+
+// ForEachReplica calls fn with every read replica and its index, in index order, e.g. to collect
+// their versions. fn sees the replica set as it was when ForEachReplica was called, it may add or
+// remove replicas without deadlocking. fn is called for every replica whatever it returns,
+// the errors it returned are joined.
+func (db *DB) ForEachReplica(fn func(index int, r *sql.DB) error) error {
+	var errs []error
+	for i, r := range db.replicas() {
+		if err := fn(i, r.db); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReplicaCount returns the number of read replicas.
+func (db *DB) ReplicaCount() int {
+	return len(db.replicas())
+}
+
+// LiveReplicaCount returns the number of read replicas which are alive: the ones up according
+// to the last check of the health checker when it runs, see StartHealthCheck, the ones answering
+// a ping otherwise. The pings are bounded by the timeout set with WithDefaultTimeout.
+func (db *DB) LiveReplicaCount() int {
+	db.m.Lock()
+	checked := db.healthCheck != nil
+	db.m.Unlock()
+	live := 0
+	if checked {
+		for _, r := range db.replicas() {
+			if !r.isDown() {
+				live++
+			}
+		}
+		return live
+	}
+	ctx, cancel := db.defaultContext()
+	defer cancel()
+	for _, err := range db.PingReplicas(ctx) {
+		if err == nil {
+			live++
+		}
+	}
+	return live
+}
+
+// Driver returns the database's underlying driver, the one of master.
+func (db *DB) Driver() driver.Driver {
+	return db.master.Driver()
+}
+
+// AddReplica adds r to the read replicas, it serves reads right away.
+// Its index is the number of replicas before the call.
+// The pool settings made with SetMaxOpenConns and the like are not applied to r, configure it beforehand.
+func (db *DB) AddReplica(r *sql.DB) error {
+	if r == nil {
+		return ErrNilReplica
+	}
+	added := db.newReplica(ReplicaConfig{DB: r})
+	db.replicasMu.Lock()
+	defer db.replicasMu.Unlock()
+	// the slice is copied so that reads iterating the previous replica set are unaffected
+	replicas := make([]*replica, len(db.readreplicas), len(db.readreplicas)+1)
+	copy(replicas, db.readreplicas)
+	db.readreplicas = append(replicas, added)
+	return nil
+}
+
+// RemoveReplica removes r from the read replicas, the replicas after it move down one index.
+// Reads already running on r are unaffected, but no new read is routed to it.
+// RemoveReplica does not close r, the caller closes it once it is drained.
+// The last replica can't be removed.
+func (db *DB) RemoveReplica(r *sql.DB) error {
+	db.replicasMu.Lock()
+	defer db.replicasMu.Unlock()
+	for i := range db.readreplicas {
+		if db.readreplicas[i].db != r {
+			continue
+		}
+		if len(db.readreplicas) == 1 {
+			return ErrLastReplica
+		}
+		db.readreplicas[i].stmts.clear()
+		db.readreplicas[i].named.clear()
+		// the slice is copied so that reads iterating the previous replica set are unaffected
+		replicas := make([]*replica, 0, len(db.readreplicas)-1)
+		replicas = append(replicas, db.readreplicas[:i]...)
+		db.readreplicas = append(replicas, db.readreplicas[i+1:]...)
+		return nil
+	}
+	return ErrReplicaNotFound
+}
+
+// replicaAt returns the replica at index, or an error if index is out of range
+func (db *DB) replicaAt(index int) (*replica, error) {
+	replicas := db.replicas()
+	if index < 0 || index >= len(replicas) {
+		return nil, fmt.Errorf(replicaIndexOutOfRangeError, index, len(replicas))
+	}
+	return replicas[index], nil
+}
+
+// QueryOnReplica executes a query on the replica at index, in the order passed to New,
+// without any balancing or failover. The error of that replica is returned as is.
+//
+// It is a diagnostic tool to observe a single replica, which the failover would otherwise mask.
+func (db *DB) QueryOnReplica(ctx context.Context, index int, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx = orBackground(ctx)
+	r, err := db.replicaAt(index)
+	if err != nil {
+		return nil, err
+	}
+	return db.queryOnReplica(ctx, index, r, query, args)
+}
+
+// queryOnReplica executes a query on replica r at index, without any balancing or failover
+func (db *DB) queryOnReplica(ctx context.Context, index int, r *replica, query string, args []interface{}) (*sql.Rows, error) {
+	db.beforeCall(ctx)
+	if err := db.checkLength(query); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	db.record(ctx, start, replicaNode(index), query, args, err)
+	if err == nil {
+		db.readServed(ctx, candidate{replica: r, index: index})
+	}
+	return rows, err
+}
+
+// ExecOnAllReplicas executes a statement concurrently on every read replica, bypassing master,
+// e.g. ANALYZE or a cache warming statement. It returns one error per replica in index order,
+// nil when the statement succeeded on the replica. There is no failover nor retry.
+//
+// Statements modifying rows, i.e. INSERT, UPDATE, DELETE, REPLACE and MERGE, fail with
+// ErrWriteOnReplica on every replica without being sent. Other writes, e.g. DDL, are sent as is:
+// they would make the replicas diverge from master, the caller must make sure they don't.
+func (db *DB) ExecOnAllReplicas(ctx context.Context, query string, args ...interface{}) []error {
+	ctx = orBackground(ctx)
+	db.beforeCall(ctx)
+	replicas := db.replicas()
+	errs := make([]error, len(replicas))
+	err := db.checkLength(query)
+	if err == nil && isDataModification(query) {
+		err = ErrWriteOnReplica
+	}
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	var wg sync.WaitGroup
+	for i, r := range replicas {
+		i, r := i, r
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			_, errs[i] = db.execOn(ctx, replicaNode(i), r.db, query, args)
+			db.record(ctx, start, replicaNode(i), query, args, errs[i])
+		}()
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,295 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_QueryOnReplica(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2; i++ {
+		mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+		_, err = db.QueryOnReplica(context.Background(), 0, "Query1")
+		assert.Nil(t, err)
+	}
+
+	// no failover to replica1
+	replica2.Close()
+	rows, err := db.QueryOnReplica(context.Background(), 1, "Query1")
+	assert.Nil(t, rows)
+	assert.Equal(t, err.Error(), "sql: database is closed")
+
+	_, err = db.QueryOnReplica(context.Background(), 2, "Query1")
+	assert.Equal(t, err.Error(), "replica index 2 is out of range, 2 replicas are configured")
+	_, err = db.QueryOnReplica(context.Background(), -1, "Query1")
+	assert.NotNil(t, err)
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
+
+func TestDB_AddReplica(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1)
+	assert.Nil(t, err)
+	assert.Equal(t, db.AddReplica(nil), ErrNilReplica)
+
+	// reads keep flowing while the replica set grows
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			db.readOrder()
+		}
+	}()
+	assert.Nil(t, db.AddReplica(replica2))
+	wg.Wait()
+
+	mock2.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	rows, err := db.QueryOnReplica(context.Background(), 1, "Query1")
+	assert.Nil(t, err)
+	rows.Close()
+	order, err := db.readOrder()
+	assert.Nil(t, err)
+	assert.Len(t, order, 2)
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
+func TestDB_RemoveReplica(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+	assert.Equal(t, db.RemoveReplica(masterDB), ErrReplicaNotFound)
+
+	// a read selected before the removal still runs on the removed replica
+	order, err := db.readOrder()
+	assert.Nil(t, err)
+	assert.Nil(t, db.RemoveReplica(replica1))
+	mock2.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	mock2.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = order[0].db.Query("Query1")
+	assert.Nil(t, err)
+	// replica2 is now at index 0
+	_, err = db.QueryOnReplica(context.Background(), 0, "Query2")
+	assert.Nil(t, err)
+	assert.Nil(t, mock2.ExpectationsWereMet())
+
+	assert.Equal(t, db.RemoveReplica(replica2), ErrLastReplica)
+	// replica1 is left open
+	assert.Nil(t, replica1.Ping())
+}
+
+func TestDB_ReplicaSetChangesUnderLoad(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicas := make([]*sql.DB, 3)
+	for i := range replicas {
+		r, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.MatchExpectationsInOrder(false)
+		for j := 0; j < 400; j++ {
+			mock.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+		}
+		replicas[i] = r
+	}
+	db, err := New(masterDB, replicas[0])
+	assert.Nil(t, err)
+
+	// reads are routed while replicas come and go, run with -race
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				rows, err := db.Query("Query1")
+				if err == nil {
+					rows.Close()
+				}
+				db.QueryOnReplica(context.Background(), 1, "Query1")
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		for _, r := range replicas[1:] {
+			assert.Nil(t, db.AddReplica(r))
+		}
+		for _, r := range replicas[1:] {
+			assert.Nil(t, db.RemoveReplica(r))
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, db.ReplicaCount(), 1)
+}
+
+func TestDB_LiveReplicaCount(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk := newFakeClock()
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2}, withClock(clk))
+	assert.Nil(t, err)
+	assert.Equal(t, db.ReplicaCount(), 2)
+	assert.Equal(t, db.LiveReplicaCount(), 2)
+
+	// without health checker the replicas are pinged
+	replica2.Close()
+	assert.Equal(t, db.LiveReplicaCount(), 1)
+
+	// with it the state of the last check is used
+	db.StartHealthCheck(context.Background(), time.Minute)
+	clk.wait(1)
+	assert.Equal(t, db.LiveReplicaCount(), 2)
+	clk.advance(time.Minute)
+	clk.wait(1)
+	assert.Equal(t, db.LiveReplicaCount(), 1)
+	db.StopHealthCheck()
+	assert.Equal(t, db.ReplicaCount(), 2)
+}
+
+func TestDB_ForEachReplica(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica3, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+
+	// the replica set can change while iterating
+	var seen []*sql.DB
+	errVersion := errors.New("version unknown")
+	err = db.ForEachReplica(func(index int, r *sql.DB) error {
+		seen = append(seen, r)
+		if index == 0 {
+			assert.Nil(t, db.AddReplica(replica3))
+			return errVersion
+		}
+		return nil
+	})
+	assert.True(t, errors.Is(err, errVersion))
+	assert.Equal(t, seen, []*sql.DB{replica1, replica2})
+	assert.Equal(t, db.ReplicaCount(), 3)
+}
+
+func TestDB_Handles(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+	assert.Equal(t, db.Master(), masterDB)
+	assert.Equal(t, db.Driver(), masterDB.Driver())
+	replicas := db.Replicas()
+	assert.Equal(t, replicas, []*sql.DB{replica1, replica2})
+	// the replica set is not affected by changes to the copy
+	replicas[0] = nil
+	assert.Equal(t, db.Replicas(), []*sql.DB{replica1, replica2})
+}
+
+func TestDB_ExecOnAllReplicas(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1, replica2)
+	assert.Nil(t, err)
+
+	mock1.ExpectExec("ANALYZE users").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock2.ExpectExec("ANALYZE users").WillReturnError(sql.ErrConnDone)
+	errs := db.ExecOnAllReplicas(context.Background(), "ANALYZE users")
+	assert.Equal(t, errs, []error{nil, sql.ErrConnDone})
+
+	// rows are never modified on replicas only
+	for _, query := range []string{"INSERT INTO users VALUES (1)", "/* purge */ delete from users", "WITH old AS (SELECT 1) UPDATE users SET a = 1"} {
+		errs = db.ExecOnAllReplicas(context.Background(), query)
+		assert.Equal(t, errs, []error{ErrWriteOnReplica, ErrWriteOnReplica})
+	}
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
@@ -0,0 +1,168 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy retries the calls to a node which failed with a transient error,
+// waiting with an exponential backoff between attempts.
+// Reads are retried on the same replica before failing over to the next one.
+type RetryPolicy struct {
+	// Attempts is the total number of attempts per node, including the first one.
+	// 0 or 1 disables retries.
+	Attempts int
+	// BaseDelay is the wait before the first retry, it doubles at every retry
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between retries, 0 means no cap
+	MaxDelay time.Duration
+	// Retryable reports whether a call failed with err must be retried.
+	// nil retries the calls failed with driver.ErrBadConn, which database/sql reports for a statement
+	// it never sent, and the reads and prepares failed with a connection reset too. An exec on master is
+	// not retried on a reset: the statement may have been applied before the connection broke,
+	// and a non-idempotent INSERT or UPDATE would be applied twice.
+	Retryable func(err error) bool
+}
+
+// WithRetryPolicy retries queries, execs and prepares according to policy.
+// A retry never waits past the deadline or the cancellation of the call's context.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(db *DB) {
+		db.retryPolicy = policy
+	}
+}
+
+// isTransient reports whether err is a connection failure which may succeed when retried
+func isTransient(err error) bool {
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// retryable reports whether a call failed with err must be retried, write telling whether
+// the call is an exec on master. Cancellations, deadlines and missing rows are never retried.
+func (p RetryPolicy) retryable(err error, write bool) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	if write {
+		return errors.Is(err, driver.ErrBadConn)
+	}
+	return isTransient(err)
+}
+
+// delay returns the backoff before the retry following attempt, attempt starting at 1.
+// Half of it is jittered with intn so concurrent callers don't retry in lockstep.
+func (p RetryPolicy) delay(attempt int, intn func(int) int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if half := int(d / 2); half > 0 {
+		d = d/2 + time.Duration(intn(half))
+	}
+	return d
+}
+
+// retry calls fn till it succeeds, fails with an error which must not be retried,
+// or the attempts of the policy or the retry budget are exhausted, and returns its last error
+func (db *DB) retry(ctx context.Context, fn func() error) error {
+	return db.retryCall(ctx, false, fn)
+}
+
+// retryWrite is retry for an exec on master, see RetryPolicy.Retryable
+func (db *DB) retryWrite(ctx context.Context, fn func() error) error {
+	return db.retryCall(ctx, true, fn)
+}
+
+func (db *DB) retryCall(ctx context.Context, write bool, fn func() error) error {
+	err := fn()
+	for attempt := 1; err != nil && attempt < db.retryPolicy.Attempts && db.retryPolicy.retryable(err, write); attempt++ {
+		if !db.retryBudget.withdraw() || !sleep(ctx, db.clock, db.retryPolicy.delay(attempt, db.randIntn)) {
+			return err
+		}
+		err = fn()
+	}
+	if err == nil {
+		db.retryBudget.deposit()
+	}
+	return err
+}
+
+// sleep waits for d, as measured by c, and reports whether it did,
+// it returns false right away when ctx is done or its deadline comes before d elapsed
+func sleep(ctx context.Context, c clock, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return false
+	}
+	elapsed, stop := c.After(d)
+	defer stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-elapsed:
+		return true
+	}
+}
+
+// retryBudgetBurst is the number of retries a retry budget allows before any call succeeded
+const retryBudgetBurst = 10
+
+// WithRetryBudget caps the retries and failovers of every call with a budget shared by all of them,
+// to keep a partial outage from turning into a retry storm. Every successful call earns ratio
+// of a retry, e.g. 0.1 allows one retry per ten successful calls, and every retry or failover
+// spends one. The budget starts with, and is capped at, 10 retries.
+// Once it is exhausted, failed calls return their error right away.
+//
+// A ratio of 0 or less disables the budget, which is the default.
+func WithRetryBudget(ratio float64) Option {
+	return func(db *DB) {
+		db.retryBudget = nil
+		if ratio > 0 {
+			db.retryBudget = &retryBudget{ratio: ratio, tokens: retryBudgetBurst}
+		}
+	}
+}
+
+// retryBudget is a token bucket of retries, a nil budget is unlimited
+type retryBudget struct {
+	m      sync.Mutex
+	ratio  float64
+	tokens float64
+}
+
+// deposit earns a share of a retry for a successful call
+func (b *retryBudget) deposit() {
+	if b == nil {
+		return
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > retryBudgetBurst {
+		b.tokens = retryBudgetBurst
+	}
+}
+
+// withdraw spends a retry and reports whether the budget allowed it
+func (b *retryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
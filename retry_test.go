@@ -0,0 +1,164 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// errFlaky is a transient error of the tests
+var errFlaky = errors.New("connection reset by peer")
+
+func TestDB_RetryPolicy(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithRetryPolicy(RetryPolicy{
+		Attempts:  3,
+		BaseDelay: time.Millisecond,
+		Retryable: func(err error) bool { return err == errFlaky },
+	}))
+	assert.Nil(t, err)
+
+	// retried on the same replica
+	mock1.ExpectQuery("Query1").WillReturnError(errFlaky)
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query1")
+	assert.Nil(t, err)
+
+	// attempts are exhausted
+	for i := 0; i < 3; i++ {
+		mock.ExpectExec("Insert1").WillReturnError(errFlaky)
+	}
+	_, err = db.Exec("Insert1")
+	assert.Equal(t, err, errFlaky)
+
+	// other errors are not retried
+	mock.ExpectPrepare("Insert2").WillReturnError(errors.New("syntax error"))
+	_, err = db.Prepare("Insert2")
+	assert.Equal(t, err.Error(), "syntax error")
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
+
+func TestDB_RetryPolicyWrites(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithRetryPolicy(RetryPolicy{Attempts: 2}))
+	assert.Nil(t, err)
+
+	// a read reset is retried
+	mock1.ExpectQuery("Query1").WillReturnError(syscall.ECONNRESET)
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.QueryContext(context.Background(), "Query1")
+	assert.Nil(t, err)
+
+	// a write reset may have been applied, it is not
+	mock.ExpectExec("Insert1").WillReturnError(syscall.ECONNRESET)
+	_, err = db.ExecContext(context.Background(), "Insert1")
+	assert.Equal(t, err, syscall.ECONNRESET)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
+
+func TestDB_RetryBudget(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2},
+		WithRetryPolicy(RetryPolicy{Attempts: 3, Retryable: func(err error) bool { return err == errFlaky }}),
+		WithRetryBudget(0.5))
+	assert.Nil(t, err)
+	db.retryBudget.tokens = 1
+
+	// a single retry is left
+	mock.ExpectExec("Insert1").WillReturnError(errFlaky)
+	mock.ExpectExec("Insert1").WillReturnError(errFlaky)
+	_, err = db.Exec("Insert1")
+	assert.Equal(t, err, errFlaky)
+
+	// the budget is exhausted, no failover either
+	mock2.ExpectQuery("Query1").WillReturnError(sql.ErrConnDone)
+	_, err = db.Query("Query1")
+	assert.True(t, errors.Is(err, ErrNoReplicaAvailable))
+	assert.True(t, errors.Is(err, sql.ErrConnDone))
+
+	// two successful calls earn a retry
+	mock.ExpectExec("Insert2").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("Insert2").WillReturnResult(sqlmock.NewResult(1, 1))
+	for i := 0; i < 2; i++ {
+		_, err = db.Exec("Insert2")
+		assert.Nil(t, err)
+	}
+	mock1.ExpectQuery("Query2").WillReturnError(sql.ErrConnDone)
+	mock2.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query2")
+	assert.Nil(t, err)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
+func TestRetryPolicy_Retryable(t *testing.T) {
+	policy := RetryPolicy{}
+	assert.True(t, policy.retryable(driver.ErrBadConn, false))
+	assert.True(t, policy.retryable(syscall.ECONNRESET, false))
+	assert.False(t, policy.retryable(errFlaky, false))
+	assert.False(t, policy.retryable(sql.ErrNoRows, false))
+	// a reset exec may have been applied
+	assert.True(t, policy.retryable(driver.ErrBadConn, true))
+	assert.False(t, policy.retryable(syscall.ECONNRESET, true))
+	policy.Retryable = func(error) bool { return true }
+	assert.False(t, policy.retryable(context.Canceled, false))
+	assert.True(t, policy.retryable(errFlaky, false))
+	assert.True(t, policy.retryable(syscall.ECONNRESET, true))
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 30 * time.Millisecond}
+	noJitter := func(int) int { return 0 }
+	assert.Equal(t, policy.delay(1, noJitter), 5*time.Millisecond)
+	assert.Equal(t, policy.delay(2, noJitter), 10*time.Millisecond)
+	assert.Equal(t, policy.delay(5, noJitter), 15*time.Millisecond)
+	fullJitter := func(n int) int { return n - 1 }
+	assert.Equal(t, policy.delay(5, fullJitter), 30*time.Millisecond-1)
+}
+
+func TestSleep(t *testing.T) {
+	assert.True(t, sleep(context.Background(), realClock{}, time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.False(t, sleep(ctx, realClock{}, time.Hour))
+	assert.True(t, time.Since(start) < time.Second)
+}
@@ -0,0 +1,52 @@
+package mydb
+
+import (
+	"context"
+	"hash/fnv"
+)
+
+// WithRoutingKey returns a copy of ctx whose reads go to the replica picked by hashing key
+// instead of the balancer, e.g. a user id so that the reads of a user hit the caches of the same replica.
+// A key goes to the same replica as long as the replica set doesn't change.
+//
+// When that replica is skipped, e.g. marked down by the health check, weighted 0 or not of the
+// highest priority, the key is hashed among the eligible replicas instead. When it fails, the read fails
+// over as usual. A replica pinned with WithReplicaAffinity is still tried first.
+func WithRoutingKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(orBackground(ctx), routingKeyKey, key)
+}
+
+// routingKeyOf returns the hash of the routing key of ctx, and whether it has one
+func routingKeyOf(ctx context.Context) (uint32, bool) {
+	key, ok := ctx.Value(routingKeyKey).(string)
+	if !ok {
+		return 0, false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32(), true
+}
+
+// keyedPick returns the position in tier of the replica a key hashed to hash goes to,
+// among the n replicas of the replica set. Like with NewWeighted, the replicas weighted 0
+// are picked only when every replica of tier is.
+func keyedPick(hash uint32, n int, tier []ReplicaState) int {
+	eligible := make([]int, 0, len(tier))
+	for i, state := range tier {
+		if state.Weight > 0 {
+			eligible = append(eligible, i)
+		}
+	}
+	if len(eligible) == 0 {
+		for i := range tier {
+			eligible = append(eligible, i)
+		}
+	}
+	index := int(hash % uint32(n))
+	for _, i := range eligible {
+		if tier[i].Index == index {
+			return i
+		}
+	}
+	return eligible[hash%uint32(len(eligible))]
+}
@@ -0,0 +1,94 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_WithRoutingKey(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicas := make([]*sql.DB, 3)
+	mocks := make([]sqlmock.Sqlmock, 3)
+	for i := range replicas {
+		replicas[i], mocks[i], err = sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := NewWithOptions(masterDB, replicas)
+	assert.Nil(t, err)
+
+	ctx := WithRoutingKey(context.Background(), "user-42")
+	hash, keyed := routingKeyOf(ctx)
+	assert.True(t, keyed)
+	target := int(hash % 3)
+
+	// the reads of the key keep hitting the same replica
+	for i := 0; i < 3; i++ {
+		mocks[target].ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+		_, err = db.QueryContext(ctx, "Query1")
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, mocks[target].ExpectationsWereMet())
+
+	// the replica fails, the read fails over
+	next := (target + 1) % 3
+	mocks[target].ExpectQuery("Query2").WillReturnError(sql.ErrConnDone)
+	mocks[next].ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.QueryContext(ctx, "Query2")
+	assert.Nil(t, err)
+	assert.Nil(t, mocks[target].ExpectationsWereMet())
+	assert.Nil(t, mocks[next].ExpectationsWereMet())
+
+	// the replica is down, the key is hashed among the others
+	db.readreplicas[target].setDown(true)
+	order, err := db.readOrderFor(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, order, 2)
+	var up []int
+	for i := range replicas {
+		if i != target {
+			up = append(up, i)
+		}
+	}
+	assert.Equal(t, order[0].index, up[hash%2])
+}
+
+func TestDB_WithRoutingKeyWeighted(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWeighted(masterDB, []WeightedReplica{{DB: replica1, Weight: 0}, {DB: replica2, Weight: 5}})
+	assert.Nil(t, err)
+
+	// the replica weighted 0 is kept for failover whatever the key
+	for i := 0; i < 8; i++ {
+		order, err := db.readOrderFor(WithRoutingKey(context.Background(), strconv.Itoa(i)))
+		assert.Nil(t, err)
+		assert.Equal(t, order[0].index, 1)
+		assert.Len(t, order, 2)
+	}
+
+	// unless no other replica is left
+	db.readreplicas[1].setDown(true)
+	order, err := db.readOrderFor(WithRoutingKey(context.Background(), "1"))
+	assert.Nil(t, err)
+	assert.Equal(t, order[0].index, 0)
+}
@@ -0,0 +1,120 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ScriptError is returned by ExecScript when one of the statements of the script fails.
+// Index is the zero based position of the failed statement in the script.
+type ScriptError struct {
+	Index     int
+	Statement string
+	Err       error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf(scriptStatementFailError, e.Index+1, e.Err.Error())
+}
+
+// Unwrap returns the underlying driver error
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// ExecScript splits a semicolon-delimited script into statements and executes
+// each of them on master db inside a single transaction.
+// It returns one sql.Result per statement, in script order.
+// Every statement goes through the guards and the hooks of ExecContext, the script
+// is refused before the transaction starts when one of them is too long, see WithMaxQueryLength.
+//
+// If any statement fails the transaction is rolled back and a *ScriptError
+// reporting the failed statement is returned.
+func (db *DB) ExecScript(ctx context.Context, script string) ([]sql.Result, error) {
+	ctx = orBackground(ctx)
+	db.beforeCall(ctx)
+	statements := splitStatements(script)
+	for i, statement := range statements {
+		if err := db.checkLength(statement); err != nil {
+			return nil, &ScriptError{Index: i, Statement: statement, Err: err}
+		}
+	}
+	tx, err := db.master.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, db.masterError("begin", err)
+	}
+	results := make([]sql.Result, 0, len(statements))
+	for i, statement := range statements {
+		result, err := db.execInTx(ctx, tx, statement)
+		if err != nil {
+			tx.Rollback()
+			return nil, &ScriptError{Index: i, Statement: statement, Err: err}
+		}
+		results = append(results, result)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, db.masterError("commit", err)
+	}
+	return results, nil
+}
+
+// execInTx executes query in tx, a transaction on master, like ExecContext executes it on master:
+// through the query hooks, the observer and the recorder. It is never retried, a statement
+// failing in a transaction fails the transaction.
+func (db *DB) execInTx(ctx context.Context, tx *sql.Tx, query string) (sql.Result, error) {
+	hooked := db.beforeQuery(ctx, query)
+	if db.observer != nil && instrumented(ctx) {
+		db.observer.OnMasterExec()
+	}
+	start := time.Now()
+	result, err := tx.ExecContext(ctx, query)
+	db.record(ctx, start, masterNode, query, nil, err)
+	err = db.masterError("exec", err)
+	db.afterQuery(ctx, query, err, hooked)
+	return result, err
+}
+
+// splitStatements splits script on semicolons which are not part of
+// a quoted string, a quoted identifier or a comment.
+// Empty statements are dropped.
+func splitStatements(script string) []string {
+	var statements []string
+	start := 0
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			// skip till the closing quote, doubled quotes are handled by
+			// simply re-entering this case on the next character
+			for i++; i < len(script) && script[i] != c; i++ {
+			}
+		case c == '-' && i+1 < len(script) && script[i+1] == '-':
+			for i += 2; i < len(script) && script[i] != '\n'; i++ {
+			}
+		case c == '/' && i+1 < len(script) && script[i+1] == '*':
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+		case c == ';':
+			statements = appendStatement(statements, script[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(script) {
+		statements = appendStatement(statements, script[start:])
+	}
+	return statements
+}
+
+func appendStatement(statements []string, statement string) []string {
+	statement = strings.TrimSpace(statement)
+	if statement == "" {
+		return statements
+	}
+	return append(statements, statement)
+}
@@ -0,0 +1,79 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_ExecScript(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hooked []string
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1},
+		WithBeforeQuery(func(ctx context.Context, query string) { hooked = append(hooked, query) }))
+	assert.Nil(t, err)
+
+	// Success case, every statement reports its own affected rows
+	mock.ExpectBegin()
+	mock.ExpectExec("Insert1").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("Update1").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+	results, err := db.ExecScript(context.Background(), "Insert1 ('a;b');\n Update1;;")
+	assert.Nil(t, err)
+	assert.Len(t, results, 2)
+	rowsAffected, err := results[1].RowsAffected()
+	assert.Nil(t, err)
+	assert.Equal(t, rowsAffected, int64(3))
+	// every statement goes through the hooks
+	assert.Equal(t, hooked, []string{"Insert1 ('a;b')", "Update1"})
+
+	// Second statement fails, transaction is rolled back
+	mock.ExpectBegin()
+	mock.ExpectExec("Insert2").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("Update2").WillReturnError(errors.New("deadlock"))
+	mock.ExpectRollback()
+	results, err = db.ExecScript(context.Background(), "Insert2; Update2")
+	assert.Nil(t, results)
+	assert.NotNil(t, err)
+	scriptErr, ok := err.(*ScriptError)
+	assert.True(t, ok)
+	assert.Equal(t, scriptErr.Index, 1)
+	assert.Equal(t, scriptErr.Statement, "Update2")
+	assert.Equal(t, err.Error(), "statement 2 of script failed: deadlock")
+
+	// a statement too long refuses the script, the transaction doesn't start
+	db.maxQueryLength = 8
+	_, err = db.ExecScript(context.Background(), "Insert3; Update3 set")
+	assert.True(t, errors.Is(err, ErrQueryTooLong))
+	assert.Equal(t, err.(*ScriptError).Index, 1)
+	db.maxQueryLength = 0
+
+	// the errors of master tell where they come from with WithErrorContext
+	db.errorContext = true
+	mock.ExpectBegin()
+	mock.ExpectExec("Insert4").WillReturnError(errors.New("deadlock"))
+	mock.ExpectRollback()
+	_, err = db.ExecScript(context.Background(), "Insert4")
+	assert.Equal(t, err.Error(), "statement 1 of script failed: master exec failed: deadlock")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSplitStatements(t *testing.T) {
+	statements := splitStatements(`insert into t values ('x;y'); -- trailing ; comment
+	/* block ; comment */ update t set "a;b" = 1;`)
+	assert.Equal(t, statements, []string{
+		"insert into t values ('x;y')",
+		"-- trailing ; comment\n\t/* block ; comment */ update t set \"a;b\" = 1",
+	})
+}
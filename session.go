@@ -0,0 +1,64 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Session is a handle bound to a context, returned by DB.WithContext.
+// Its methods are the ones of DB without the context argument, they use the bound context.
+// A Session shares the pools of its DB and only carries call-scoped settings, it is cheap to create.
+type Session struct {
+	db  *DB
+	ctx context.Context
+}
+
+// WithContext returns a Session issuing its calls with ctx.
+func (db *DB) WithContext(ctx context.Context) *Session {
+	return &Session{db: db, ctx: orBackground(ctx)}
+}
+
+// ForceMaster returns a copy of the session whose reads and prepares are served by master, see WithMaster.
+func (s *Session) ForceMaster() *Session {
+	return &Session{db: s.db, ctx: WithMaster(s.ctx)}
+}
+
+// NoInstrumentation returns a copy of the session which turns off hooks and metrics, see WithNoInstrumentation.
+func (s *Session) NoInstrumentation() *Session {
+	return &Session{db: s.db, ctx: WithNoInstrumentation(s.ctx)}
+}
+
+// ReadOnlyExec returns a copy of the session whose execs are served by read replicas, see WithReadOnlyExec.
+func (s *Session) ReadOnlyExec() *Session {
+	return &Session{db: s.db, ctx: WithReadOnlyExec(s.ctx)}
+}
+
+// Context returns the context the session is bound to.
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// Query executes a query that returns rows, see DB.QueryContext.
+func (s *Session) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.QueryContext(s.ctx, query, args...)
+}
+
+// QueryRow executes a query that is expected to return at most one row, see DB.QueryRowContext.
+func (s *Session) QueryRow(query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRowContext(s.ctx, query, args...)
+}
+
+// Exec executes a query without returning any rows, see DB.ExecContext.
+func (s *Session) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.db.ExecContext(s.ctx, query, args...)
+}
+
+// Prepare creates a prepared statement, see DB.PrepareContext.
+func (s *Session) Prepare(query string) (*sql.Stmt, error) {
+	return s.db.PrepareContext(s.ctx, query)
+}
+
+// Begin starts a transaction, see DB.BeginTx.
+func (s *Session) Begin(opts *sql.TxOptions) (*sql.Tx, error) {
+	return s.db.BeginTx(s.ctx, opts)
+}
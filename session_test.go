@@ -0,0 +1,53 @@
+package mydb
+
+import (
+	"context"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1)
+	assert.Nil(t, err)
+	ctx := context.WithValue(context.Background(), contextKey(-1), "request")
+	session := db.WithContext(ctx)
+	assert.Equal(t, session.Context(), ctx)
+
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = session.Query("Query1")
+	assert.Nil(t, err)
+	mock.ExpectExec("Insert1").WillReturnResult(sqlmock.NewResult(1, 1))
+	_, err = session.Exec("Insert1")
+	assert.Nil(t, err)
+
+	// reads of a session forced on master
+	master := session.ForceMaster()
+	mock.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = master.Query("Query2")
+	assert.Nil(t, err)
+	mock.ExpectQuery("Query3").WillReturnRows(sqlmock.NewRows([]string{"col1"}).AddRow(1))
+	var col1 int
+	assert.Nil(t, master.QueryRow("Query3").Scan(&col1))
+	mock.ExpectPrepare("Select1")
+	_, err = master.Prepare("Select1")
+	assert.Nil(t, err)
+	assert.Equal(t, master.Context().Value(contextKey(-1)), "request")
+
+	// the original session is left untouched
+	mock1.ExpectQuery("Query4").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = session.Query("Query4")
+	assert.Nil(t, err)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
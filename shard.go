@@ -0,0 +1,58 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+)
+
+// WithShardMasters shards the writes made with ExecOnShard across master, which is shard 0,
+// and masters, which are the shards 1 to len(masters). Exec and the like keep writing to master.
+// Reads are spread across the read replicas as usual. The constructors fail when one of masters is nil.
+func WithShardMasters(masters ...*sql.DB) Option {
+	return func(db *DB) {
+		db.shardMasters = masters
+	}
+}
+
+// ShardCount returns the number of write shards, 1 unless WithShardMasters is used.
+func (db *DB) ShardCount() int {
+	return len(db.shardMasters) + 1
+}
+
+// ExecOnShard executes a query without returning any rows on the master of the shard of shardKey,
+// e.g. a tenant id. The shard is picked by hashing shardKey, so a key always goes to the same shard
+// as long as the shard masters don't change.
+func (db *DB) ExecOnShard(ctx context.Context, shardKey string, query string, args ...interface{}) (sql.Result, error) {
+	ctx = orBackground(ctx)
+	start := db.beforeQuery(ctx, query)
+	result, err := db.execOnShard(ctx, shardKey, query, args)
+	db.afterQuery(ctx, query, err, start)
+	return result, err
+}
+
+// execOnShard executes a query without returning any rows on the master of the shard of shardKey, see ExecOnShard
+func (db *DB) execOnShard(ctx context.Context, shardKey string, query string, args []interface{}) (sql.Result, error) {
+	db.beforeCall(ctx)
+	if err := db.checkLength(query); err != nil {
+		return nil, err
+	}
+	shard := db.shardOf(shardKey)
+	if shard == 0 {
+		return db.execOnMaster(ctx, masterNode, db.master, query, args)
+	}
+	return db.execOnMaster(ctx, shardNode(shard), db.shardMasters[shard-1], query, args)
+}
+
+// shardOf returns the shard of shardKey
+func (db *DB) shardOf(shardKey string) int {
+	h := fnv.New32a()
+	h.Write([]byte(shardKey))
+	return int(h.Sum32() % uint32(db.ShardCount()))
+}
+
+// shardNode returns the identity of the master of shard i, i > 0, reported to hooks
+func shardNode(i int) string {
+	return fmt.Sprintf("master-%d", i)
+}
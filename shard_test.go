@@ -0,0 +1,83 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_ExecOnShard(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	shard1, shardMock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hooked []string
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithShardMasters(shard1),
+		WithBeforeQuery(func(ctx context.Context, query string) { hooked = append(hooked, query) }))
+	assert.Nil(t, err)
+	assert.Equal(t, db.ShardCount(), 2)
+
+	mocks := []sqlmock.Sqlmock{mock, shardMock1}
+	seen := map[int]bool{}
+	for i := 0; len(seen) < 2; i++ {
+		key := fmt.Sprintf("tenant-%d", i)
+		shard := db.shardOf(key)
+		seen[shard] = true
+		mocks[shard].ExpectExec("Insert1").WillReturnResult(sqlmock.NewResult(1, 1))
+		_, err = db.ExecOnShard(context.Background(), key, "Insert1")
+		assert.Nil(t, err)
+		// a key always goes to the same shard
+		assert.Equal(t, db.shardOf(key), shard)
+	}
+
+	// the execs go through the hooks and the guards of the other execs
+	assert.Equal(t, hooked[0], "Insert1")
+	db.maxQueryLength = 3
+	_, err = db.ExecOnShard(context.Background(), "tenant-0", "Insert1")
+	assert.Equal(t, err, ErrQueryTooLong)
+	db.maxQueryLength = 0
+
+	// without a shard key, writes go to master
+	mock.ExpectExec("Insert2").WillReturnResult(sqlmock.NewResult(1, 1))
+	_, err = db.Exec("Insert2")
+	assert.Nil(t, err)
+
+	mock.ExpectClose()
+	shardMock1.ExpectClose()
+	mock1.ExpectClose()
+	assert.Nil(t, db.Close())
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, shardMock1.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+
+	// the shard masters are pinged with the others
+	masterDB, _, err = sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err = sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err = NewWithOptions(masterDB, []*sql.DB{replica1}, WithShardMasters(shard1))
+	assert.Nil(t, err)
+	assert.Equal(t, db.Ping().Error(), "shard master db 1 ping fail: sql: database is closed")
+
+	// a nil shard master is rejected
+	_, err = NewWithOptions(masterDB, []*sql.DB{replica1}, WithShardMasters(shard1, nil))
+	assert.Equal(t, err.Error(), "shard master db 2 is nil: master db must not be nil")
+	assert.True(t, errors.Is(err, ErrNilMaster))
+}
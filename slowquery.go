@@ -0,0 +1,60 @@
+package mydb
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SlowQuery describes a query, exec or prepare which took longer than the threshold set with WithSlowQueryLog.
+type SlowQuery struct {
+	// Query is the query text, as issued by the caller
+	Query string
+	// Args are the query args, each of them replaced by "<redacted>"
+	// unless arg redaction is disabled with WithArgRedaction(false)
+	Args []interface{}
+	// Node is the node which executed the query, empty when no node could execute it
+	Node string
+	// Replica is the index of the replica which executed the query, -1 for master
+	Replica int
+	// Duration is the time the query took to return
+	Duration time.Duration
+}
+
+// WithSlowQueryLog registers fn, invoked with every query, exec and prepare which took threshold or longer,
+// e.g. to log them. Nothing is measured beyond what the DB already does while no threshold is set.
+// Queries issued with a context returned by WithNoInstrumentation are not reported.
+func WithSlowQueryLog(threshold time.Duration, fn func(SlowQuery)) Option {
+	return func(db *DB) {
+		db.slowQueryThreshold = threshold
+		db.onSlowQuery = fn
+	}
+}
+
+// slowQuery reports the query issued at start to node if it was slow
+func (db *DB) slowQuery(ctx context.Context, start time.Time, node string, query string, args []interface{}) {
+	if db.onSlowQuery == nil || !instrumented(ctx) {
+		return
+	}
+	d := time.Since(start)
+	if d < db.slowQueryThreshold {
+		return
+	}
+	db.onSlowQuery(SlowQuery{
+		Query:    query,
+		Args:     db.hookArgs(args),
+		Node:     node,
+		Replica:  nodeReplicaIndex(node),
+		Duration: d,
+	})
+}
+
+// nodeReplicaIndex returns the index of the replica identified by node, -1 when node is not a replica
+func nodeReplicaIndex(node string) int {
+	index, err := strconv.Atoi(strings.TrimPrefix(node, "replica-"))
+	if err != nil || !strings.HasPrefix(node, "replica-") {
+		return -1
+	}
+	return index
+}
@@ -0,0 +1,57 @@
+package mydb
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_SlowQueryLog(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var slow []SlowQuery
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithSlowQueryLog(20*time.Millisecond, func(q SlowQuery) {
+		slow = append(slow, q)
+	}))
+	assert.Nil(t, err)
+
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	mock1.ExpectQuery("Query2").WillDelayFor(30 * time.Millisecond).WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	mock.ExpectExec("Insert1").WillDelayFor(30 * time.Millisecond).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectPrepare("Insert2").WillDelayFor(30 * time.Millisecond)
+	_, err = db.Query("Query1")
+	assert.Nil(t, err)
+	_, err = db.Query("Query2", "secret")
+	assert.Nil(t, err)
+	_, err = db.Exec("Insert1", 42)
+	assert.Nil(t, err)
+	_, err = db.Prepare("Insert2")
+	assert.Nil(t, err)
+
+	assert.Len(t, slow, 3)
+	assert.Equal(t, slow[0].Query, "Query2")
+	assert.Equal(t, slow[0].Node, "replica-0")
+	assert.Equal(t, slow[0].Replica, 0)
+	assert.Equal(t, slow[0].Args, []interface{}{redactedArg})
+	assert.True(t, slow[0].Duration >= 20*time.Millisecond)
+	assert.Equal(t, slow[1].Query, "Insert1")
+	assert.Equal(t, slow[1].Replica, -1)
+	assert.Equal(t, slow[2].Query, "Insert2")
+	assert.Equal(t, slow[2].Node, masterNode)
+}
+
+func TestNodeReplicaIndex(t *testing.T) {
+	assert.Equal(t, nodeReplicaIndex("replica-3"), 3)
+	assert.Equal(t, nodeReplicaIndex(masterNode), -1)
+	assert.Equal(t, nodeReplicaIndex(""), -1)
+	assert.Equal(t, nodeReplicaIndex("master-1"), -1)
+}
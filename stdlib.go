@@ -0,0 +1,322 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+)
+
+// errStdlibOpen is returned when the driver of the facade returned by StdlibDB is opened by name
+var errStdlibOpen = errors.New(stdlibOpenError)
+
+// StdlibDB returns a *sql.DB routing its calls through db, for the libraries accepting
+// only a *sql.DB, e.g. sqlx or gorm. Queries are served by the read replicas, execs and
+// transactions by master, exactly like the calls made on db.
+//
+// The facade is backed by a database/sql driver delegating to db, which comes with tradeoffs:
+//   - a connection of the facade is not a connection of a node: every call is routed on its own,
+//     so session state, e.g. SET statements or temporary tables, does not carry over from one call
+//     to the next, even through a *sql.Conn of the facade. Transactions are the exception, the
+//     calls made in a transaction run on it.
+//   - rows are read from the node then handed over value by value, along with the column types
+//     reported by the node.
+//   - the pool settings and Close of the facade don't affect db, whose nodes stay open.
+func (db *DB) StdlibDB() *sql.DB {
+	return sql.OpenDB(stdlibConnector{db: db})
+}
+
+// stdlibConnector opens the connections of the facade returned by StdlibDB
+type stdlibConnector struct {
+	db *DB
+	// cached prepares the statements through the statement caches, see DB.PrepareContext
+	cached bool
+}
+
+func (c stdlibConnector) Connect(context.Context) (driver.Conn, error) {
+	return &stdlibConn{db: c.db, cached: c.cached}, nil
+}
+
+func (c stdlibConnector) Driver() driver.Driver {
+	return stdlibDriver{}
+}
+
+// stdlibDriver is the driver of the facade, it can only be used through stdlibConnector
+type stdlibDriver struct{}
+
+func (stdlibDriver) Open(string) (driver.Conn, error) {
+	return nil, errStdlibOpen
+}
+
+// stdlibConn is a connection of the facade, it routes every call through db,
+// or through tx while a transaction is running on it
+type stdlibConn struct {
+	db     *DB
+	tx     *sql.Tx
+	cached bool
+}
+
+func (c *stdlibConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *stdlibConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt *sql.Stmt
+	var err error
+	switch {
+	case c.tx != nil:
+		stmt, err = c.tx.PrepareContext(ctx, query)
+	case c.cached:
+		return c.prepareBound(ctx, query)
+	default:
+		stmt, err = c.db.PrepareContext(ctx, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stdlibStmt{stmt}, nil
+}
+
+// prepareBound prepares a query bound by DB.prepareCached on its node, through the statement cache
+// of the node. The query is routed again if its replica was removed.
+func (c *stdlibConn) prepareBound(ctx context.Context, bound string) (driver.Stmt, error) {
+	id, query := unbindQuery(bound)
+	node, cache := c.db.master, c.db.masterStmts
+	if id != 0 {
+		r := c.db.replicaByID(id)
+		if r == nil {
+			p, err := c.db.prepareContext(ctx, query, true)
+			if err != nil {
+				return nil, err
+			}
+			return stdlibCachedStmt{stdlibStmt{p.stmt}, p.entry}, nil
+		}
+		node, cache = r.db, r.stmts
+	}
+	var stmt *sql.Stmt
+	var entry *cachedStmt
+	err := c.db.retry(ctx, func() error {
+		var err error
+		stmt, entry, err = prepareOn(ctx, node, cache, query)
+		return err
+	})
+	if err != nil {
+		if id == 0 {
+			err = c.db.masterError("prepare", err)
+		}
+		return nil, err
+	}
+	return stdlibCachedStmt{stdlibStmt{stmt}, entry}, nil
+}
+
+func (c *stdlibConn) Close() error {
+	return nil
+}
+
+func (c *stdlibConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *stdlibConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.IsolationLevel(opts.Isolation), ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	c.tx = tx
+	return stdlibTx{c}, nil
+}
+
+func (c *stdlibConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	var rows *sql.Rows
+	var err error
+	if c.tx != nil {
+		rows, err = c.tx.QueryContext(ctx, query, namedArgs(args)...)
+	} else {
+		rows, err = c.db.QueryContext(ctx, query, namedArgs(args)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newStdlibRows(rows)
+}
+
+func (c *stdlibConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if c.tx != nil {
+		return c.tx.ExecContext(ctx, query, namedArgs(args)...)
+	}
+	return c.db.ExecContext(ctx, query, namedArgs(args)...)
+}
+
+func (c *stdlibConn) Ping(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
+// CheckNamedValue accepts every argument as is, the node converts it
+func (c *stdlibConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+// stdlibTx is a transaction of the facade
+type stdlibTx struct {
+	conn *stdlibConn
+}
+
+func (t stdlibTx) Commit() error {
+	tx := t.conn.tx
+	t.conn.tx = nil
+	return tx.Commit()
+}
+
+func (t stdlibTx) Rollback() error {
+	tx := t.conn.tx
+	t.conn.tx = nil
+	return tx.Rollback()
+}
+
+// stdlibStmt is a prepared statement of the facade
+type stdlibStmt struct {
+	stmt *sql.Stmt
+}
+
+func (s stdlibStmt) Close() error {
+	return s.stmt.Close()
+}
+
+// NumInput returns -1, the node checks the number of arguments
+func (s stdlibStmt) NumInput() int {
+	return -1
+}
+
+func (s stdlibStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), valueArgs(args))
+}
+
+func (s stdlibStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), valueArgs(args))
+}
+
+func (s stdlibStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.stmt.ExecContext(ctx, namedArgs(args)...)
+}
+
+func (s stdlibStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := s.stmt.QueryContext(ctx, namedArgs(args)...)
+	if err != nil {
+		return nil, err
+	}
+	return newStdlibRows(rows)
+}
+
+func (s stdlibStmt) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+// stdlibCachedStmt is a prepared statement of the facade taken from a statement cache,
+// closing it hands the statement back to the cache
+type stdlibCachedStmt struct {
+	stdlibStmt
+	// entry is nil when the node the statement is prepared on doesn't cache statements
+	entry *cachedStmt
+}
+
+func (s stdlibCachedStmt) Close() error {
+	if s.entry == nil {
+		return s.stmt.Close()
+	}
+	s.entry.cache.release(s.entry)
+	return nil
+}
+
+// stdlibRows hands the rows read from a node over to the facade
+type stdlibRows struct {
+	rows    *sql.Rows
+	columns []string
+	types   []*sql.ColumnType
+}
+
+func newStdlibRows(rows *sql.Rows) (*stdlibRows, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return &stdlibRows{rows: rows, columns: columns, types: types}, nil
+}
+
+func (r *stdlibRows) Columns() []string {
+	return r.columns
+}
+
+func (r *stdlibRows) ColumnTypeDatabaseTypeName(index int) string {
+	return r.types[index].DatabaseTypeName()
+}
+
+func (r *stdlibRows) ColumnTypeScanType(index int) reflect.Type {
+	return r.types[index].ScanType()
+}
+
+func (r *stdlibRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return r.types[index].Nullable()
+}
+
+func (r *stdlibRows) ColumnTypeLength(index int) (length int64, ok bool) {
+	return r.types[index].Length()
+}
+
+func (r *stdlibRows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	return r.types[index].DecimalSize()
+}
+
+func (r *stdlibRows) Close() error {
+	return r.rows.Close()
+}
+
+func (r *stdlibRows) Next(dest []driver.Value) error {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	values := make([]interface{}, len(dest))
+	pointers := make([]interface{}, len(dest))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := r.rows.Scan(pointers...); err != nil {
+		return err
+	}
+	for i := range values {
+		dest[i] = values[i]
+	}
+	return nil
+}
+
+// namedArgs converts the arguments received by the facade into the arguments of db
+func namedArgs(args []driver.NamedValue) []interface{} {
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			converted[i] = sql.Named(arg.Name, arg.Value)
+		} else {
+			converted[i] = arg.Value
+		}
+	}
+	return converted
+}
+
+// valueArgs converts positional arguments into named values
+func valueArgs(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
@@ -0,0 +1,60 @@
+package mydb
+
+import (
+	"context"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_StdlibDB(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1)
+	assert.Nil(t, err)
+	std := db.StdlibDB()
+	defer std.Close()
+
+	// reads go to the replica
+	mock1.ExpectQuery("SELECT name FROM users").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("ross"))
+	var name string
+	assert.Nil(t, std.QueryRow("SELECT name FROM users WHERE id = ?", 1).Scan(&name))
+	assert.Equal(t, name, "ross")
+
+	// writes to master
+	mock.ExpectExec("UPDATE users").WithArgs("ross", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	result, err := std.Exec("UPDATE users SET name = ? WHERE id = ?", "ross", 1)
+	assert.Nil(t, err)
+	affected, err := result.RowsAffected()
+	assert.Nil(t, err)
+	assert.Equal(t, affected, int64(1))
+
+	// the calls made in a transaction run on it
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM users").WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("ross"))
+	mock.ExpectCommit()
+	tx, err := std.BeginTx(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Nil(t, tx.QueryRow("SELECT name FROM users").Scan(&name))
+	assert.Nil(t, tx.Commit())
+
+	// statements are prepared where db prepares them
+	mock1.ExpectPrepare("SELECT id FROM users").ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(7)))
+	stmt, err := std.Prepare("SELECT id FROM users")
+	assert.Nil(t, err)
+	var id int
+	assert.Nil(t, stmt.QueryRow().Scan(&id))
+	assert.Equal(t, id, 7)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
@@ -0,0 +1,188 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// masterNode is the identity of master db reported to hooks
+const masterNode = "master"
+
+// replicaNode returns the identity of the read replica at index i reported to hooks
+func replicaNode(i int) string {
+	return fmt.Sprintf("replica-%d", i)
+}
+
+// Stmt is a prepared statement returned by PrepareStmt or NamedStmt.
+// It remembers the node it is bound to, so its lifetime can be reported on Close.
+//
+// A statement bound to a replica which the health check, see StartHealthCheck, marked down
+// is orphaned: its next Exec, Query or QueryRow prepares it again on a healthy replica first.
+type Stmt struct {
+	*sql.Stmt
+	m        sync.Mutex
+	db       *DB
+	query    string
+	useCache bool
+	node     string
+	prepared time.Time
+	onClose  func(node string, lived time.Duration)
+	// entry is set when the statement is owned by the statement cache
+	entry *cachedStmt
+	// replica is the replica the statement is bound to, nil for master
+	replica *replica
+	closed  bool
+}
+
+// Node returns the identity of the node the statement is prepared on,
+// i.e. "master" or "replica-<index>"
+func (s *Stmt) Node() string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.node
+}
+
+// Orphaned reports whether the replica the statement is bound to is marked down by the health check.
+func (s *Stmt) Orphaned() bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.orphaned()
+}
+
+func (s *Stmt) orphaned() bool {
+	return s.replica != nil && s.replica.isDown()
+}
+
+// current returns the statement to run, prepared again on a healthy replica when orphaned.
+// The orphaned statement is kept when preparing it again fails.
+func (s *Stmt) current(ctx context.Context) *sql.Stmt {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed || !s.orphaned() {
+		return s.Stmt
+	}
+	p, err := s.db.prepare(ctx, s.query, s.useCache)
+	if err != nil {
+		return s.Stmt
+	}
+	s.release()
+	s.Stmt, s.node, s.entry, s.replica = p.stmt, p.node, p.entry, p.replica
+	return s.Stmt
+}
+
+// ExecContext executes the statement, see sql.Stmt.
+func (s *Stmt) ExecContext(ctx context.Context, args ...interface{}) (sql.Result, error) {
+	ctx = orBackground(ctx)
+	return s.current(ctx).ExecContext(ctx, args...)
+}
+
+// Exec executes the statement, see sql.Stmt.
+func (s *Stmt) Exec(args ...interface{}) (sql.Result, error) {
+	ctx, cancel := s.db.defaultContext()
+	defer cancel()
+	return s.ExecContext(ctx, args...)
+}
+
+// QueryContext executes the statement as a query, see sql.Stmt.
+func (s *Stmt) QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error) {
+	ctx = orBackground(ctx)
+	return s.current(ctx).QueryContext(ctx, args...)
+}
+
+// Query executes the statement as a query, see sql.Stmt.
+func (s *Stmt) Query(args ...interface{}) (*sql.Rows, error) {
+	ctx, cancel := s.db.rowsContext()
+	rows, err := s.QueryContext(ctx, args...)
+	if err != nil {
+		cancel()
+	}
+	return rows, err
+}
+
+// QueryRowContext executes the statement as a query expected to return at most one row, see sql.Stmt.
+func (s *Stmt) QueryRowContext(ctx context.Context, args ...interface{}) *sql.Row {
+	ctx = orBackground(ctx)
+	return s.current(ctx).QueryRowContext(ctx, args...)
+}
+
+// QueryRow executes the statement as a query expected to return at most one row, see sql.Stmt.
+func (s *Stmt) QueryRow(args ...interface{}) *sql.Row {
+	ctx, cancel := s.db.rowsContext()
+	row := s.QueryRowContext(ctx, args...)
+	if row.Err() != nil {
+		cancel()
+	}
+	return row
+}
+
+// Close closes the statement. A cached or registered statement is handed back to the
+// statement cache instead, which closes it once evicted.
+// If a hook is registered with WithOnStmtClose it is invoked with the node
+// identity and how long the statement lived.
+func (s *Stmt) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	err := s.release()
+	if s.onClose != nil {
+		s.onClose(s.node, time.Since(s.prepared))
+	}
+	return err
+}
+
+// release closes the underlying statement, or hands it back to the statement cache
+func (s *Stmt) release() error {
+	if s.entry != nil {
+		s.entry.cache.release(s.entry)
+		return nil
+	}
+	return s.Stmt.Close()
+}
+
+// PrepareStmt is like Prepare but returns a *Stmt which knows the node it is bound to.
+func (db *DB) PrepareStmt(query string) (*Stmt, error) {
+	ctx, cancel := db.defaultContext()
+	defer cancel()
+	return db.PrepareStmtContext(ctx, query)
+}
+
+// PrepareStmtContext is like PrepareContext but returns a *Stmt which knows the node it is bound to.
+// The statement is taken from the statement cache when it is enabled with WithStmtCache.
+func (db *DB) PrepareStmtContext(ctx context.Context, query string) (*Stmt, error) {
+	ctx = orBackground(ctx)
+	start := db.beforeQuery(ctx, query)
+	p, err := db.prepareContext(ctx, query, instrumented(ctx))
+	db.afterQuery(ctx, query, err, start)
+	if err != nil {
+		return nil, err
+	}
+	s := &Stmt{
+		Stmt:     p.stmt,
+		db:       db,
+		query:    query,
+		useCache: instrumented(ctx),
+		node:     p.node,
+		prepared: time.Now(),
+		entry:    p.entry,
+		replica:  p.replica,
+	}
+	if instrumented(ctx) {
+		s.onClose = db.onStmtClose
+	}
+	return s, nil
+}
+
+// WithOnStmtClose registers a hook invoked whenever a *Stmt returned by
+// PrepareStmt is closed, with the node the statement was bound to and
+// how long it lived.
+func WithOnStmtClose(fn func(node string, lived time.Duration)) Option {
+	return func(db *DB) {
+		db.onStmtClose = fn
+	}
+}
@@ -0,0 +1,83 @@
+package mydb
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_PrepareStmt(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var closedNodes []string
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithOnStmtClose(func(node string, lived time.Duration) {
+		closedNodes = append(closedNodes, node)
+		assert.True(t, lived >= 0)
+	}))
+	assert.Nil(t, err)
+
+	mock1.ExpectPrepare("Select1")
+	stmt, err := db.PrepareStmt("Select1")
+	assert.Nil(t, err)
+	assert.Equal(t, stmt.Node(), "replica-0")
+	assert.Nil(t, stmt.Close())
+
+	mock.ExpectPrepare("Insert")
+	stmt, err = db.PrepareStmt("Insert")
+	assert.Nil(t, err)
+	assert.Equal(t, stmt.Node(), "master")
+	assert.Nil(t, stmt.Close())
+
+	assert.Equal(t, closedNodes, []string{"replica-0", "master"})
+
+	// prepare failure on the single replica is returned as is
+	replica1.Close()
+	stmt, err = db.PrepareStmt("Select2")
+	assert.Nil(t, stmt)
+	assert.Equal(t, err.Error(), "sql: database is closed")
+}
+
+func TestStmt_Orphaned(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2})
+	assert.Nil(t, err)
+
+	mock2.ExpectPrepare("Select1").WillBeClosed()
+	stmt, err := db.PrepareStmt("Select1")
+	assert.Nil(t, err)
+	assert.Equal(t, stmt.Node(), "replica-1")
+	assert.False(t, stmt.Orphaned())
+
+	// replica2 goes down, the statement is prepared again on replica1 when used
+	db.readreplicas[1].setDown(true)
+	assert.True(t, stmt.Orphaned())
+	mock1.ExpectPrepare("Select1").ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	rows, err := stmt.Query()
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Close())
+	assert.Equal(t, stmt.Node(), "replica-0")
+	assert.False(t, stmt.Orphaned())
+
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
@@ -0,0 +1,204 @@
+package mydb
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// WithStmtCache enables caching of the statements prepared with Prepare, PrepareContext and PrepareStmt.
+// Every node keeps up to size statements keyed by query, the least recently used
+// statement is closed when the cache is full and no longer used. The size of a replica cache can be
+// overridden with ReplicaConfig.StmtCacheSize.
+// The cache of a replica is cleared when it is removed or marked down by the health check.
+//
+// The *sql.Stmt returned by Prepare and PrepareContext is served through a facade like the one
+// of StdlibDB, so that closing it hands the cached statement back. Callers close it as usual.
+// The statement stays bound to the node it was prepared on: when database/sql prepares it again
+// for another connection of the facade, it is taken from the cache of that node whatever the
+// context of the call, and only routed again if the replica was removed meanwhile.
+// Its rows are handed over value by value, along with the column types reported by the node.
+func WithStmtCache(size int) Option {
+	return func(db *DB) {
+		db.stmtCacheSize = size
+	}
+}
+
+// cachedStmt is a statement owned by a stmtCache.
+// It is closed once evicted and no longer used by any *Stmt.
+type cachedStmt struct {
+	cache   *stmtCache
+	query   string
+	stmt    *sql.Stmt
+	refs    int
+	evicted bool
+}
+
+// stmtCache is a LRU cache of the statements prepared on one node
+type stmtCache struct {
+	size  int // 0 for a cache without bound, see newNamedStmts
+	m     sync.Mutex
+	order *list.List // of *cachedStmt, most recently used first
+	items map[string]*list.Element
+}
+
+// newStmtCache returns a cache holding up to size statements, or nil if size <= 0
+func newStmtCache(size int) *stmtCache {
+	if size <= 0 {
+		return nil
+	}
+	return &stmtCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+// get returns the cached statement for query, or nil on a miss.
+// The caller must release the returned statement.
+func (c *stmtCache) get(query string) *cachedStmt {
+	c.m.Lock()
+	defer c.m.Unlock()
+	elem, ok := c.items[query]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(elem)
+	entry := elem.Value.(*cachedStmt)
+	entry.refs++
+	return entry
+}
+
+// put adds stmt to the cache, evicting the least recently used statements.
+// If query was cached concurrently, stmt is closed and the cached one is returned.
+// The caller must release the returned statement.
+func (c *stmtCache) put(query string, stmt *sql.Stmt) *cachedStmt {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if elem, ok := c.items[query]; ok {
+		stmt.Close()
+		c.order.MoveToFront(elem)
+		entry := elem.Value.(*cachedStmt)
+		entry.refs++
+		return entry
+	}
+	entry := &cachedStmt{cache: c, query: query, stmt: stmt, refs: 1}
+	c.items[query] = c.order.PushFront(entry)
+	for c.size > 0 && c.order.Len() > c.size {
+		c.evict(c.order.Back())
+	}
+	return entry
+}
+
+// release gives back a statement returned by get or put
+func (c *stmtCache) release(entry *cachedStmt) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	entry.refs--
+	if entry.evicted && entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+// evict removes elem from the cache, closing its statement if nobody is using it.
+// c.m must be held.
+func (c *stmtCache) evict(elem *list.Element) {
+	entry := c.order.Remove(elem).(*cachedStmt)
+	delete(c.items, entry.query)
+	entry.evicted = true
+	if entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+// clear evicts every statement, c may be nil
+func (c *stmtCache) clear() {
+	if c == nil {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	for c.order.Len() > 0 {
+		c.evict(c.order.Back())
+	}
+}
+
+// ClearStmtCache evicts every statement cached with WithStmtCache, on master and every replica.
+// The statements still used by a *Stmt are closed once it is closed.
+func (db *DB) ClearStmtCache() {
+	db.masterStmts.clear()
+	for _, r := range db.replicas() {
+		r.stmts.clear()
+	}
+}
+
+// closeCachedStmts closes the facade serving the statements of PrepareContext, see WithStmtCache
+func (db *DB) closeCachedStmts() {
+	if db.cachedStmts != nil {
+		db.cachedStmts.Close()
+	}
+}
+
+// prepareCached prepares query through the statement caches for PrepareContext.
+// The statement is served by the facade when it is cached, as is otherwise.
+func (db *DB) prepareCached(ctx context.Context, query string) (*sql.Stmt, error) {
+	p, err := db.prepareContext(ctx, query, true)
+	if err != nil || p.entry == nil {
+		return p.stmt, err
+	}
+	// the facade takes its own reference on the statement
+	defer p.entry.cache.release(p.entry)
+	return db.cachedStmts.PrepareContext(ctx, bindQuery(p.replica, query))
+}
+
+// bindQuery binds query to the node r, master when r is nil, for the facade of PrepareContext
+func bindQuery(r *replica, query string) string {
+	var id uint64
+	if r != nil {
+		id = r.id
+	}
+	return strconv.FormatUint(id, 10) + "\x00" + query
+}
+
+// unbindQuery returns the query bound by bindQuery along with the id of its replica, 0 for master
+func unbindQuery(bound string) (uint64, string) {
+	node, query, _ := strings.Cut(bound, "\x00")
+	id, _ := strconv.ParseUint(node, 10, 64)
+	return id, query
+}
+
+// replicaByID returns the replica of the given id, nil if it is no longer in the replica set
+func (db *DB) replicaByID(id uint64) *replica {
+	for _, r := range db.replicas() {
+		if r.id == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// cacheIf returns c when caching is requested, nil otherwise
+func cacheIf(useCache bool, c *stmtCache) *stmtCache {
+	if !useCache {
+		return nil
+	}
+	return c
+}
+
+// prepareOn prepares query on conn, going through cache when it is not nil
+func prepareOn(ctx context.Context, conn *sql.DB, cache *stmtCache, query string) (*sql.Stmt, *cachedStmt, error) {
+	if cache != nil {
+		if entry := cache.get(query); entry != nil {
+			return entry.stmt, entry, nil
+		}
+	}
+	stmt, err := conn.PrepareContext(ctx, query)
+	if err != nil || cache == nil {
+		return stmt, nil, err
+	}
+	entry := cache.put(query, stmt)
+	return entry.stmt, entry, nil
+}
@@ -0,0 +1,272 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_StmtCache(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// replica1 caches a single statement, replica2 doesn't cache at all
+	db, err := NewWithReplicas(masterDB, []ReplicaConfig{
+		{DB: replica1, StmtCacheSize: 1},
+		{DB: replica2, StmtCacheSize: -1},
+	}, WithStmtCache(10), WithBalancer(lastReplica{}))
+	assert.Nil(t, err)
+	assert.Equal(t, db.masterStmts.size, 10)
+	assert.Equal(t, db.readreplicas[0].stmts.size, 1)
+	assert.Nil(t, db.readreplicas[1].stmts)
+
+	// replica2 prepares on every call
+	mock2.ExpectPrepare("Select1")
+	mock2.ExpectPrepare("Select1")
+	for i := 0; i < 2; i++ {
+		stmt, err := db.PrepareStmt("Select1")
+		assert.Nil(t, err)
+		assert.Nil(t, stmt.Close())
+	}
+	assert.Nil(t, mock2.ExpectationsWereMet())
+
+	// replica1 prepares once and reuses the statement
+	db.balancer = &roundRobin{count: 1}
+	mock1.ExpectPrepare("Select1").WillBeClosed()
+	stmt1, err := db.PrepareStmt("Select1")
+	assert.Nil(t, err)
+	assert.Equal(t, stmt1.Node(), "replica-0")
+	stmt2, err := db.PrepareStmt("Select1")
+	assert.Nil(t, err)
+	assert.Equal(t, stmt1.Stmt, stmt2.Stmt)
+	assert.Nil(t, stmt1.Close())
+	assert.Nil(t, stmt2.Close())
+
+	// Select2 evicts and closes Select1
+	mock1.ExpectPrepare("Select2")
+	stmt, err := db.PrepareStmt("Select2")
+	assert.Nil(t, err)
+	assert.Nil(t, stmt.Close())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
+
+func TestStmtCache_EvictInUse(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectPrepare("Select1")
+	mock.ExpectPrepare("Select2")
+	stmt1, err := conn.Prepare("Select1")
+	assert.Nil(t, err)
+	stmt2, err := conn.Prepare("Select2")
+	assert.Nil(t, err)
+
+	cache := newStmtCache(1)
+	entry1 := cache.put("Select1", stmt1)
+	entry2 := cache.put("Select2", stmt2)
+	// Select1 is evicted but still in use, it stays open till released
+	assert.True(t, entry1.evicted)
+	assert.Nil(t, cache.get("Select1"))
+	mock.ExpectExec("Select1").WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = entry1.stmt.Exec()
+	assert.Nil(t, err)
+	cache.release(entry1)
+	_, err = entry1.stmt.Exec()
+	assert.Equal(t, err.Error(), "sql: statement is closed")
+
+	cache.release(entry2)
+	assert.False(t, entry2.evicted)
+	assert.Nil(t, newStmtCache(0))
+}
+
+func TestDB_ClearStmtCache(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2}, WithStmtCache(4))
+	assert.Nil(t, err)
+
+	mock2.ExpectPrepare("Select1").WillBeClosed()
+	stmt, err := db.PrepareStmt("Select1")
+	assert.Nil(t, err)
+	assert.Nil(t, stmt.Close())
+	db.ClearStmtCache()
+	assert.Nil(t, db.readreplicas[1].stmts.get("Select1"))
+	assert.Nil(t, mock2.ExpectationsWereMet())
+
+	// the cache of a removed replica is cleared
+	mock1.ExpectPrepare("Select2").WillBeClosed()
+	stmt, err = db.PrepareStmt("Select2")
+	assert.Nil(t, err)
+	assert.Nil(t, stmt.Close())
+	cache := db.readreplicas[0].stmts
+	assert.Nil(t, db.RemoveReplica(replica1))
+	assert.Nil(t, cache.get("Select2"))
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
+
+func TestDB_PrepareContextCached(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithStmtCache(4))
+	assert.Nil(t, err)
+
+	// the query is prepared once and shared by both statements
+	mock1.ExpectPrepare("SELECT id FROM users").WillBeClosed()
+	mock1.ExpectQuery("SELECT id FROM users").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(7)))
+	stmt1, err := db.Prepare("SELECT id FROM users")
+	assert.Nil(t, err)
+	stmt2, err := db.PrepareContext(context.Background(), "SELECT id FROM users")
+	assert.Nil(t, err)
+	assert.Equal(t, db.readreplicas[0].stmts.order.Len(), 1)
+
+	// closing one leaves the other working
+	assert.Nil(t, stmt1.Close())
+	var id int
+	assert.Nil(t, stmt2.QueryRow().Scan(&id))
+	assert.Equal(t, id, 7)
+	assert.Nil(t, stmt2.Close())
+
+	// the cache closes the statement once evicted
+	db.ClearStmtCache()
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
+
+// typedConnector opens connections serving "id" BIGINT rows and counting their prepares
+type typedConnector struct {
+	prepares *int32
+}
+
+func (c typedConnector) Connect(context.Context) (driver.Conn, error) {
+	return typedConn{c.prepares}, nil
+}
+
+func (c typedConnector) Driver() driver.Driver {
+	return nil
+}
+
+type typedConn struct {
+	prepares *int32
+}
+
+func (c typedConn) Prepare(string) (driver.Stmt, error) {
+	atomic.AddInt32(c.prepares, 1)
+	return typedStmt{}, nil
+}
+
+func (c typedConn) Close() error {
+	return nil
+}
+
+func (c typedConn) Begin() (driver.Tx, error) {
+	return nil, driver.ErrSkip
+}
+
+type typedStmt struct{}
+
+func (typedStmt) Close() error {
+	return nil
+}
+
+func (typedStmt) NumInput() int {
+	return 0
+}
+
+func (typedStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, driver.ErrSkip
+}
+
+func (typedStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &typedRows{}, nil
+}
+
+type typedRows struct {
+	done bool
+}
+
+func (r *typedRows) Columns() []string {
+	return []string{"id"}
+}
+
+func (r *typedRows) ColumnTypeDatabaseTypeName(int) string {
+	return "BIGINT"
+}
+
+func (r *typedRows) Close() error {
+	return nil
+}
+
+func (r *typedRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(7)
+	return nil
+}
+
+func TestDB_PrepareContextCachedBound(t *testing.T) {
+	var masterPrepares, replicaPrepares int32
+	masterDB := sql.OpenDB(typedConnector{&masterPrepares})
+	replica1 := sql.OpenDB(typedConnector{&replicaPrepares})
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithStmtCache(4))
+	assert.Nil(t, err)
+
+	stmt, err := db.PrepareContext(context.Background(), "SELECT id FROM users")
+	assert.Nil(t, err)
+	// the open rows hold the connection of the facade, so the next query prepares the statement
+	// again on another one, with a context which would route it to master
+	rows1, err := stmt.QueryContext(context.Background())
+	assert.Nil(t, err)
+	rows2, err := stmt.QueryContext(WithMaster(context.Background()))
+	assert.Nil(t, err)
+	// both run on the cached statement of the replica, which is prepared on two of its connections
+	assert.Equal(t, atomic.LoadInt32(&masterPrepares), int32(0))
+	assert.Equal(t, atomic.LoadInt32(&replicaPrepares), int32(2))
+	assert.Equal(t, db.readreplicas[0].stmts.order.Front().Value.(*cachedStmt).refs, 2)
+
+	// the column types of the node come through the facade
+	types, err := rows2.ColumnTypes()
+	assert.Nil(t, err)
+	assert.Equal(t, types[0].DatabaseTypeName(), "BIGINT")
+	for _, rows := range []*sql.Rows{rows1, rows2} {
+		var id int
+		assert.True(t, rows.Next())
+		assert.Nil(t, rows.Scan(&id))
+		assert.Equal(t, id, 7)
+		assert.Nil(t, rows.Close())
+	}
+	assert.Nil(t, stmt.Close())
+	assert.Equal(t, db.readreplicas[0].stmts.order.Front().Value.(*cachedStmt).refs, 0)
+}
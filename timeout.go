@@ -0,0 +1,36 @@
+package mydb
+
+import (
+	"context"
+	"time"
+)
+
+// WithDefaultTimeout bounds the calls made without a context, i.e. Query, QueryRow, Exec, Prepare,
+// PrepareStmt, Ping and the methods of Stmt, to d, so that a hung node can't block them forever.
+// The calls taking a context are unaffected, as is Begin, whose transaction outlives the call.
+// A d of 0 or less leaves them unbounded, which is the default.
+//
+// The rows of Query, QueryRow and of the Query methods of Stmt are bounded as well: reading them fails
+// once d elapsed. Their timer can't be stopped when the rows are closed, so it and its context are
+// held till d elapses; with a long d and many such calls, prefer QueryContext and cancel its context.
+func WithDefaultTimeout(d time.Duration) Option {
+	return func(db *DB) {
+		db.defaultTimeout = d
+	}
+}
+
+// defaultContext returns the context of a call made without one, bounded by the default timeout.
+// cancel must be called once the call returned.
+func (db *DB) defaultContext() (ctx context.Context, cancel context.CancelFunc) {
+	if db.defaultTimeout <= 0 {
+		return context.Background(), func() {}
+	}
+	return context.WithTimeout(context.Background(), db.defaultTimeout)
+}
+
+// rowsContext is defaultContext for the calls returning rows, which are read after the call returned.
+// cancel must be called when the call failed. The rows hold the context otherwise, it can't be
+// canceled when they are closed and is released once the default timeout elapsed.
+func (db *DB) rowsContext() (ctx context.Context, cancel context.CancelFunc) {
+	return db.defaultContext()
+}
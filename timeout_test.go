@@ -0,0 +1,45 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_DefaultTimeout(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithDefaultTimeout(20*time.Millisecond))
+	assert.Nil(t, err)
+
+	mock.ExpectExec("Insert1").WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(1, 1))
+	start := time.Now()
+	_, err = db.Exec("Insert1")
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+
+	// rows are still readable after the call returned
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	rows, err := db.Query("Query1")
+	assert.Nil(t, err)
+	assert.True(t, rows.Next())
+	var id int
+	assert.Nil(t, rows.Scan(&id))
+	assert.Equal(t, id, 1)
+	assert.Nil(t, rows.Close())
+
+	// calls taking a context are unaffected
+	mock.ExpectExec("Insert2").WillDelayFor(40 * time.Millisecond).WillReturnResult(sqlmock.NewResult(1, 1))
+	_, err = db.ExecContext(context.Background(), "Insert2")
+	assert.Nil(t, err)
+}
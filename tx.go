@@ -0,0 +1,91 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// txKey is the context key of the transaction bound to a DB
+type txKey struct {
+	db *DB
+}
+
+// WithReadsThroughActiveTx makes reads issued with a context carrying a transaction,
+// bound with ContextWithTx, run through that transaction instead of a read replica.
+// It gives read-your-writes consistency inside the transaction.
+// Once the transaction is committed or rolled back reads go to replicas again.
+func WithReadsThroughActiveTx(enabled bool) Option {
+	return func(db *DB) {
+		db.readsThroughTx = enabled
+	}
+}
+
+// ContextWithTx returns a copy of ctx carrying tx, a transaction started with this DB.
+// See WithReadsThroughActiveTx.
+func (db *DB) ContextWithTx(ctx context.Context, tx *sql.Tx) context.Context {
+	ctx = orBackground(ctx)
+	return context.WithValue(ctx, txKey{db}, tx)
+}
+
+// BeginTxContext is like BeginTx, but also returns a copy of ctx carrying the transaction.
+func (db *DB) BeginTxContext(ctx context.Context, opts *sql.TxOptions) (context.Context, *sql.Tx, error) {
+	ctx = orBackground(ctx)
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return ctx, nil, err
+	}
+	return db.ContextWithTx(ctx, tx), tx, nil
+}
+
+// BeginTxOn starts a transaction on the replica at index, in the order passed to New,
+// without any balancing or failover, e.g. for a reporting transaction needing an extension
+// installed on a single replica. opts are passed as is, the caller sets ReadOnly when the driver supports it.
+//
+// It fails with ErrNoReplicaAvailable when the replica is marked down by the health check,
+// and with an error errors.Is matches with ErrNoReplicaAvailable when it can't be reached.
+func (db *DB) BeginTxOn(ctx context.Context, index int, opts *sql.TxOptions) (*sql.Tx, error) {
+	ctx = orBackground(ctx)
+	r, err := db.replicaAt(index)
+	if err != nil {
+		return nil, err
+	}
+	db.beforeCall(ctx)
+	if r.isDown() {
+		return nil, ErrNoReplicaAvailable
+	}
+	tx, err := r.db.BeginTx(ctx, opts)
+	if err != nil {
+		// the transaction targets a single replica
+		failed := failures{replicas: 1}
+		failed.add(index, err)
+		return nil, failed.unavailable()
+	}
+	return tx, nil
+}
+
+// beginOnReplicas starts a read-only transaction on a read replica, with failover
+func (db *DB) beginOnReplicas(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	order, err := db.readOrderFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var tx *sql.Tx
+	res := db.tryReplicas(ctx, order, err, replicaRead{
+		attempt: func(r candidate) error {
+			var err error
+			tx, err = r.db.BeginTx(ctx, opts)
+			return err
+		},
+		unreachable: true,
+	})
+	return tx, res.err
+}
+
+// activeTx returns the transaction reads made with ctx must go through, if any
+func (db *DB) activeTx(ctx context.Context) *sql.Tx {
+	if !db.readsThroughTx {
+		return nil
+	}
+	tx, _ := ctx.Value(txKey{db}).(*sql.Tx)
+	return tx
+}
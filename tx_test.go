@@ -0,0 +1,205 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_ReadsThroughActiveTx(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithReadsThroughActiveTx(true))
+	assert.Nil(t, err)
+
+	mock.ExpectBegin()
+	ctx, tx, err := db.BeginTxContext(context.Background(), nil)
+	assert.Nil(t, err)
+
+	// reads with the tx context see the uncommitted writes of the transaction
+	mock.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	rows, err := db.QueryContext(ctx, "Query1")
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Close())
+	mock.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	var id int
+	assert.Nil(t, db.QueryRowContext(ctx, "Query2").Scan(&id))
+	assert.Equal(t, id, 2)
+	mock.ExpectPrepare("Select1")
+	stmt, err := db.PrepareStmtContext(ctx, "Select1")
+	assert.Nil(t, err)
+	assert.Equal(t, stmt.Node(), "master")
+
+	// reads without the tx context still go to replicas
+	mock1.ExpectQuery("Query3").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err = db.QueryContext(context.Background(), "Query3")
+	assert.Nil(t, err)
+
+	// finished transaction is ignored
+	mock.ExpectCommit()
+	assert.Nil(t, tx.Commit())
+	mock1.ExpectQuery("Query4").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err = db.QueryContext(ctx, "Query4")
+	assert.Nil(t, err)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
+
+func TestDB_ReadsThroughActiveTx_Disabled(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(masterDB, replica1)
+	assert.Nil(t, err)
+
+	mock.ExpectBegin()
+	ctx, _, err := db.BeginTxContext(context.Background(), nil)
+	assert.Nil(t, err)
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err = db.QueryContext(ctx, "Query1")
+	assert.Nil(t, err)
+	assert.Nil(t, mock1.ExpectationsWereMet())
+}
+
+func TestDB_BeginReadOnly(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2})
+	assert.Nil(t, err)
+	readOnly := &sql.TxOptions{ReadOnly: true}
+
+	// failover from replica2 to replica1
+	mock2.ExpectBegin().WillReturnError(sql.ErrConnDone)
+	mock1.ExpectBegin()
+	mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	mock1.ExpectCommit()
+	tx, err := db.BeginTx(context.Background(), readOnly)
+	assert.Nil(t, err)
+	_, err = tx.Query("Query1")
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Commit())
+
+	// no replica available
+	mock1.ExpectBegin().WillReturnError(sql.ErrConnDone)
+	mock2.ExpectBegin().WillReturnError(sql.ErrConnDone)
+	_, err = db.BeginTx(context.Background(), readOnly)
+	assert.True(t, errors.Is(err, ErrNoReplicaAvailable))
+
+	// unless forced to master, which also beats a replica affinity
+	mock.ExpectBegin()
+	mock.ExpectBegin()
+	_, err = db.BeginTx(WithMaster(context.Background()), readOnly)
+	assert.Nil(t, err)
+	_, _, err = db.BeginTxContext(WithMaster(WithReplicaAffinity(context.Background())), readOnly)
+	assert.Nil(t, err)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
+func TestDB_BeginTxOn(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2})
+	assert.Nil(t, err)
+	readOnly := &sql.TxOptions{ReadOnly: true}
+
+	// the transaction runs on the replica asked for, whatever the balancer
+	for i := 0; i < 2; i++ {
+		mock1.ExpectBegin()
+		mock1.ExpectCommit()
+		tx, err := db.BeginTxOn(context.Background(), 0, readOnly)
+		assert.Nil(t, err)
+		assert.Nil(t, tx.Commit())
+	}
+
+	_, err = db.BeginTxOn(context.Background(), 2, readOnly)
+	assert.Equal(t, err.Error(), "replica index 2 is out of range, 2 replicas are configured")
+
+	// no failover
+	mock2.ExpectBegin().WillReturnError(sql.ErrConnDone)
+	_, err = db.BeginTxOn(context.Background(), 1, readOnly)
+	assert.True(t, errors.Is(err, ErrNoReplicaAvailable))
+	assert.True(t, errors.Is(err, sql.ErrConnDone))
+	db.readreplicas[1].setDown(true)
+	_, err = db.BeginTxOn(context.Background(), 1, readOnly)
+	assert.Equal(t, err, ErrNoReplicaAvailable)
+
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
+func TestDB_BeginReadOnlyUnavailable(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failovers []FailoverEvent
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1, replica2},
+		WithOnFailover(func(e FailoverEvent) { failovers = append(failovers, e) }))
+	assert.Nil(t, err)
+	readOnly := &sql.TxOptions{ReadOnly: true}
+
+	// the failover is reported like the one of a read
+	mock2.ExpectBegin().WillReturnError(sql.ErrConnDone)
+	mock1.ExpectBegin()
+	_, err = db.BeginTx(context.Background(), readOnly)
+	assert.Nil(t, err)
+	assert.Len(t, failovers, 1)
+	assert.Equal(t, failovers[0].From, 1)
+	assert.Equal(t, failovers[0].To, 0)
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+
+	// a single replica left which can't be reached
+	db, err = New(masterDB, replica1)
+	assert.Nil(t, err)
+	replica1.Close()
+	_, err = db.BeginTx(context.Background(), readOnly)
+	assert.True(t, errors.Is(err, ErrNoReplicaAvailable))
+}
@@ -0,0 +1,78 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// VerifyMasterWritable confirms master db accepts writes by running probe on it,
+// e.g. a temporary table create/drop or a check of the server read_only flag.
+// probe must return an error when master is read-only.
+//
+// It catches a read replica being configured as master by mistake.
+func (db *DB) VerifyMasterWritable(ctx context.Context, probe func(*sql.DB) error) error {
+	ctx = orBackground(ctx)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := probe(db.master); err != nil {
+		return fmt.Errorf(masterNotWritableError, err)
+	}
+	return nil
+}
+
+// WithMasterWriteCheck makes NewWithOptions run VerifyMasterWritable with probe
+// and fail when master db doesn't accept writes.
+func WithMasterWriteCheck(probe func(*sql.DB) error) Option {
+	return func(db *DB) {
+		db.masterWriteProbe = probe
+	}
+}
+
+// WithReplicaReadOnlyCheck makes NewWithOptions run VerifyReadOnly, with query as the probe,
+// and fail when a replica accepts writes. query must return a single value telling whether
+// the server is read-only, e.g. "SHOW transaction_read_only" on Postgres or "SELECT @@read_only" on MySQL.
+func WithReplicaReadOnlyCheck(query string) Option {
+	return func(db *DB) {
+		db.replicaReadOnlyProbe = query
+	}
+}
+
+// VerifyReadOnly confirms every replica is read-only by running the probe query set with
+// WithReplicaReadOnlyCheck on it. A probe value of "on", "true", "yes" or a non-zero number is read-only.
+// The errors of the replicas which are writable, or failed the probe, are joined.
+//
+// It catches a writable master being configured as read replica by mistake,
+// where misrouted writes would corrupt data.
+func (db *DB) VerifyReadOnly(ctx context.Context) error {
+	ctx = orBackground(ctx)
+	if db.replicaReadOnlyProbe == "" {
+		return ErrNoReadOnlyProbe
+	}
+	var errs []error
+	for i, r := range db.replicas() {
+		var value string
+		if err := r.db.QueryRowContext(ctx, db.replicaReadOnlyProbe).Scan(&value); err != nil {
+			errs = append(errs, fmt.Errorf(replicaReadOnlyCheckFailError, i+1, err))
+			continue
+		}
+		if !isReadOnlyValue(value) {
+			errs = append(errs, fmt.Errorf(replicaWritableError, i+1))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isReadOnlyValue reports whether value, returned by a read-only probe, means read-only
+func isReadOnlyValue(value string) bool {
+	switch value = strings.ToLower(strings.TrimSpace(value)); value {
+	case "on", "true", "yes":
+		return true
+	case "", "off", "false", "no":
+		return false
+	}
+	return strings.Trim(value, "0.") != ""
+}
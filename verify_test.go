@@ -0,0 +1,92 @@
+package mydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_VerifyMasterWritable(t *testing.T) {
+	masterDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe := func(master *sql.DB) error {
+		_, err := master.Exec("CREATE TEMPORARY TABLE probe")
+		return err
+	}
+
+	// master accepts writes
+	mock.ExpectExec("CREATE TEMPORARY TABLE probe").WillReturnResult(sqlmock.NewResult(0, 0))
+	db, err := NewWithOptions(masterDB, []*sql.DB{replica1}, WithMasterWriteCheck(probe))
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	// master is read-only
+	errReadOnly := errors.New("read-only transaction")
+	mock.ExpectExec("CREATE TEMPORARY TABLE probe").WillReturnError(errReadOnly)
+	db, err = NewWithOptions(masterDB, []*sql.DB{replica1}, WithMasterWriteCheck(probe))
+	assert.Nil(t, db)
+	assert.NotNil(t, err)
+	assert.Equal(t, err.Error(), "master db is not writable: read-only transaction")
+	assert.True(t, errors.Is(err, errReadOnly))
+
+	// context is already cancelled
+	db, err = New(masterDB, replica1)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, db.VerifyMasterWritable(ctx, probe), context.Canceled)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDB_VerifyReadOnly(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicas := []*sql.DB{replica1, replica2}
+
+	// replicas are read-only
+	mock1.ExpectQuery("SHOW transaction_read_only").WillReturnRows(sqlmock.NewRows([]string{"transaction_read_only"}).AddRow("on"))
+	mock2.ExpectQuery("SHOW transaction_read_only").WillReturnRows(sqlmock.NewRows([]string{"transaction_read_only"}).AddRow(1))
+	db, err := NewWithOptions(masterDB, replicas, WithReplicaReadOnlyCheck("SHOW transaction_read_only"))
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	// replica2 is writable
+	mock1.ExpectQuery("SHOW transaction_read_only").WillReturnRows(sqlmock.NewRows([]string{"transaction_read_only"}).AddRow("on"))
+	mock2.ExpectQuery("SHOW transaction_read_only").WillReturnRows(sqlmock.NewRows([]string{"transaction_read_only"}).AddRow(0))
+	db, err = NewWithOptions(masterDB, replicas, WithReplicaReadOnlyCheck("SHOW transaction_read_only"))
+	assert.Nil(t, db)
+	assert.Equal(t, err.Error(), "replica db 2 is writable")
+
+	// without a probe, then with replica1 failing it
+	db, err = New(masterDB, replicas...)
+	assert.Nil(t, err)
+	assert.Equal(t, db.VerifyReadOnly(context.Background()), ErrNoReadOnlyProbe)
+	db.replicaReadOnlyProbe = "SHOW transaction_read_only"
+	mock1.ExpectQuery("SHOW transaction_read_only").WillReturnError(errors.New("permission denied"))
+	mock2.ExpectQuery("SHOW transaction_read_only").WillReturnRows(sqlmock.NewRows([]string{"transaction_read_only"}).AddRow("off"))
+	err = db.VerifyReadOnly(context.Background())
+	assert.Equal(t, err.Error(), "replica db 1 read-only check fail: permission denied\nreplica db 2 is writable")
+
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
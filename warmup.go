@@ -0,0 +1,42 @@
+package mydb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// WarmupStatements prepares every query on every healthy replica and keeps them in the
+// statement cache, so the first PrepareStmt of those hot queries doesn't pay the prepare cost.
+// Replicas whose statement cache is disabled, see WithStmtCache, are skipped;
+// ErrStmtCacheDisabled is returned when no replica has a statement cache, there is nothing to warm up.
+//
+// Every node error is returned, joined: a *ReplicaPingError for a replica which is down,
+// and one error per query failing to prepare on a replica.
+func (db *DB) WarmupStatements(ctx context.Context, queries []string) error {
+	ctx = orBackground(ctx)
+	var errs []error
+	cached := false
+	for i, r := range db.replicas() {
+		if r.stmts == nil {
+			continue
+		}
+		cached = true
+		if err := r.db.PingContext(ctx); err != nil {
+			errs = append(errs, &ReplicaPingError{Index: i, Err: err})
+			continue
+		}
+		for _, query := range queries {
+			_, entry, err := prepareOn(ctx, r.db, r.stmts, query)
+			if err != nil {
+				errs = append(errs, fmt.Errorf(replicaWarmupFailError, i+1, query, err))
+				continue
+			}
+			r.stmts.release(entry)
+		}
+	}
+	if !cached {
+		return ErrStmtCacheDisabled
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,52 @@
+package mydb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_WarmupStatements(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica3, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewWithReplicas(masterDB, []ReplicaConfig{{DB: replica1}, {DB: replica2}, {DB: replica3, StmtCacheSize: -1}},
+		WithStmtCache(4))
+	assert.Nil(t, err)
+
+	mock1.ExpectPrepare("Select1")
+	mock1.ExpectPrepare("Select2").WillReturnError(errors.New("syntax error"))
+	replica2.Close()
+	err = db.WarmupStatements(context.Background(), []string{"Select1", "Select2"})
+	assert.Equal(t, err.Error(), "replica db 1 prepare of \"Select2\" fail: syntax error\nreplica db 2 ping fail: sql: database is closed")
+	var pingErr *ReplicaPingError
+	assert.True(t, errors.As(err, &pingErr))
+	assert.Equal(t, pingErr.Index, 1)
+	assert.Nil(t, mock1.ExpectationsWereMet())
+
+	// the warmed up statement is served from the cache
+	entry := db.readreplicas[0].stmts.get("Select1")
+	assert.NotNil(t, entry)
+	db.readreplicas[0].stmts.release(entry)
+
+	// without a statement cache there is nothing to warm up
+	db, err = New(masterDB, replica1)
+	assert.Nil(t, err)
+	assert.Equal(t, db.WarmupStatements(context.Background(), []string{"Select1"}), ErrStmtCacheDisabled)
+}
@@ -0,0 +1,76 @@
+package mydb
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// WeightedReplica is a read replica passed to NewWeighted along with its share of the reads.
+type WeightedReplica struct {
+	DB *sql.DB
+	// Weight is the share of reads routed to the replica relative to the others,
+	// e.g. a replica weighted 3 serves about three times the reads of a replica weighted 1.
+	// A weight of 0 or less means reads are routed to the replica only when no other replica is left.
+	Weight int
+}
+
+// NewWeighted returns a new instance of library handle i.e. DB
+// which spreads reads among replicas according to their weight.
+// at least one read replica instance is expected
+func NewWeighted(master *sql.DB, readreplicas []WeightedReplica, opts ...Option) (*DB, error) {
+	configs := make([]ReplicaConfig, len(readreplicas))
+	for i := range readreplicas {
+		configs[i] = ReplicaConfig{DB: readreplicas[i].DB}
+	}
+	opts = append([]Option{WithBalancer(&weightedRoundRobin{})}, opts...)
+	db, err := NewWithReplicas(master, configs, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range readreplicas {
+		db.readreplicas[i].weight = 0
+		if readreplicas[i].Weight > 0 {
+			db.readreplicas[i].weight = readreplicas[i].Weight
+		}
+	}
+	return db, nil
+}
+
+// weightedRoundRobin is the smooth weighted round-robin Balancer used by NewWeighted,
+// it interleaves the picks of heavier replicas rather than sending them in bursts.
+// Replicas weighted 0 are picked only when every replica is.
+type weightedRoundRobin struct {
+	m sync.Mutex
+	// current is the running weight of every replica, indexed by ReplicaState.Index
+	current []int
+	rr      roundRobin
+}
+
+func (w *weightedRoundRobin) Pick(replicas []ReplicaState) int {
+	w.m.Lock()
+	defer w.m.Unlock()
+	total := 0
+	picked := -1
+	for i, state := range replicas {
+		if state.Weight <= 0 {
+			continue
+		}
+		for len(w.current) <= state.Index {
+			w.current = append(w.current, 0)
+		}
+		w.current[state.Index] += state.Weight
+		total += state.Weight
+		if picked < 0 || w.current[state.Index] > w.current[replicas[picked].Index] {
+			picked = i
+		}
+	}
+	if picked < 0 {
+		return w.rr.Pick(replicas)
+	}
+	w.current[replicas[picked].Index] -= total
+	return picked
+}
+
+func (w *weightedRoundRobin) Name() string {
+	return "weighted"
+}
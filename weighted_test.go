@@ -0,0 +1,59 @@
+package mydb
+
+import (
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeightedRoundRobin_Pick(t *testing.T) {
+	w := &weightedRoundRobin{}
+	replicas := []ReplicaState{{Index: 0, Weight: 3}, {Index: 1, Weight: 1}, {Index: 2, Weight: 0}}
+	histogram := make([]int, len(replicas))
+	var picks []int
+	for i := 0; i < 8; i++ {
+		picked := w.Pick(replicas)
+		histogram[picked]++
+		picks = append(picks, picked)
+	}
+	assert.Equal(t, histogram, []int{6, 2, 0})
+	// heavier replicas are interleaved with the lighter ones
+	assert.Equal(t, picks[:4], []int{0, 0, 1, 0})
+
+	// every replica weighted 0
+	assert.Contains(t, []int{0, 1}, w.Pick([]ReplicaState{{Index: 0}, {Index: 1}}))
+}
+
+func TestDB_NewWeighted(t *testing.T) {
+	masterDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewWeighted(masterDB, nil)
+	assert.Equal(t, err.Error(), noReadReplicaError)
+
+	db, err := NewWeighted(masterDB, []WeightedReplica{{DB: replica1, Weight: 2}, {DB: replica2}})
+	assert.Nil(t, err)
+	// replica2 is weighted 0, it serves reads only once replica1 failed
+	for i := 0; i < 3; i++ {
+		mock1.ExpectQuery("Query1").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+		_, err = db.Query("Query1")
+		assert.Nil(t, err)
+	}
+	mock1.ExpectQuery("Query2").WillReturnError(errors.New("bad connection"))
+	mock2.ExpectQuery("Query2").WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+	_, err = db.Query("Query2")
+	assert.Nil(t, err)
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}